@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// bucketsCmd represents the buckets command
+var bucketsCmd = &cobra.Command{
+	Use:   "buckets",
+	Short: "Manage the buckets in an R2 account",
+}
+
+// bucketsLsCmd represents the buckets ls command
+var bucketsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the buckets in an R2 account",
+	Long: `List the buckets in an R2 account with their creation date, jurisdiction and
+location hint. Running ls without arguments does the same.
+
+Buckets outside of any jurisdiction and those in each jurisdiction are listed
+together. Jurisdictions other than the profile's that its API token can't
+access are skipped.
+
+Pass --with-stats to also count each bucket's objects and their total size.
+This lists every object in every bucket, so it can take a while for large
+buckets; buckets are scanned concurrently.
+
+Examples:
+  # List all buckets
+  r2 buckets ls
+
+  # List buckets whose names start with logs-, with their sizes
+  r2 buckets ls --filter 'logs-*' --with-stats
+
+  # List buckets as JSON
+  r2 buckets ls -o json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listBuckets(cmd)
+	},
+}
+
+// addBucketListFlags adds the flags controlling bucket listings to a command.
+func addBucketListFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("with-stats", false, "Count each bucket's objects and their total size")
+	cmd.Flags().String("filter", "", "Only list buckets whose names match a glob, e.g. 'logs-*'")
+	cmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
+
+// listBuckets prints the buckets in the account of the command's profile, as configured by the
+// flags added by addBucketListFlags.
+func listBuckets(cmd *cobra.Command) {
+	// Get profile client
+	profileName, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := pkg.Client(getProfile(profileName))
+
+	opts := pkg.ListBucketsOptions{WithLocation: true}
+	if opts.WithStats, err = cmd.Flags().GetBool("with-stats"); err != nil {
+		log.Fatal(err)
+	}
+	if opts.Filter, err = cmd.Flags().GetString("filter"); err != nil {
+		log.Fatal(err)
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch output {
+	case "text":
+		err = c.PrintBucketsWithOptions(opts)
+	case "json":
+		var buckets []pkg.BucketInfo
+		buckets, err = c.GetBuckets(opts)
+		if buckets == nil {
+			if err != nil {
+				log.Fatal(err)
+			}
+			buckets = []pkg.BucketInfo{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(buckets); encodeErr != nil {
+			log.Fatal(encodeErr)
+		}
+	default:
+		log.Fatalf("Invalid --output value %q: must be text or json", output)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't list all bucket details:\n%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	// Add the buckets command and its subcommands to the root command
+	rootCmd.AddCommand(bucketsCmd)
+	bucketsCmd.AddCommand(bucketsLsCmd)
+
+	// Add bucket listing flags
+	addBucketListFlags(bucketsLsCmd)
+}
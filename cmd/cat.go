@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// catCmd represents the cat command
+var catCmd = &cobra.Command{
+	Use:   "cat r2://bucket/key [r2://bucket/key...]",
+	Short: "Stream R2 objects to stdout",
+	Long: `Stream one or more R2 objects to standard output without creating local files.
+
+The cat command is the reverse of pipe: objects are written to stdout in the
+order given, so they can be fed into other programs. A byte range may be
+requested to peek at large objects without downloading them in full. Objects
+encrypted server-side with a customer-provided key (SSE-C) need the key given
+with --sse-c-key or --sse-c-key-file. Objects uploaded with --compress are
+decompressed, and can only be read whole, unless --no-decompress is given;
+other objects, e.g. pre-compressed .gz files, are printed as stored.
+
+Examples:
+  # Print an object
+  r2 cat r2://bucket/config.json
+
+  # Decompress and query a log
+  r2 cat r2://logs/2024-01-01.json.gz | zcat | jq .
+
+  # Print the first KiB of an object
+  r2 cat r2://logs/huge.log --range bytes=0-1023
+
+  # Print the last 4096 bytes of an object
+  r2 cat r2://logs/huge.log --tail 4096
+
+  # Print everything after the first MiB
+  r2 cat r2://logs/huge.log --offset 1048576`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		opts := pkg.GetOptions{Range: getRange(cmd), SSECustomerKey: getSSECustomerKey(cmd, "sse-c-key")}
+		if opts.NoDecompress, err = cmd.Flags().GetBool("no-decompress"); err != nil {
+			log.Fatal(err)
+		}
+
+		// Stream each object to stdout in turn
+		for _, arg := range args {
+			if !pkg.IsR2URI(arg) {
+				log.Fatalf("Path %s is not a valid R2 URI", arg)
+			}
+			uri := pkg.ParseR2URISafe(arg)
+			b := c.Bucket(uri.Bucket)
+
+			body, err := b.GetWithOptions(uri.Path, opts)
+			if err != nil {
+				log.Fatalf("Couldn't get file r2://%s/%s: %v\n", uri.Bucket, uri.Path, err)
+			}
+			_, err = io.Copy(os.Stdout, body)
+			body.Close()
+			if err != nil {
+				log.Fatalf("Couldn't stream file r2://%s/%s: %v\n", uri.Bucket, uri.Path, err)
+			}
+		}
+	},
+}
+
+func init() {
+	// Add the cat command to the root command
+	rootCmd.AddCommand(catCmd)
+
+	// Add range flags
+	addRangeFlags(catCmd)
+	catCmd.Flags().Bool("no-decompress", false, "Print objects compressed with --compress as stored")
+
+	// Add flags for SSE-C keys
+	addSSECustomerKeyFlags(catCmd, false)
+}
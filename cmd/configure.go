@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/erdos-one/r2/pkg"
 
@@ -22,15 +24,61 @@ var (
 	accountIDRe       = regexp.MustCompile(`account_id\s*=\s*(\w+)`)
 	accessKeyIDRe     = regexp.MustCompile(`access_key_id\s*=\s*(\w+)`)
 	secretAccessKeyRe = regexp.MustCompile(`secret_access_key\s*=\s*(\w+)`)
+	maxAttemptsRe     = regexp.MustCompile(`max_attempts\s*=\s*(\d+)`)
+	retryModeRe       = regexp.MustCompile(`retry_mode\s*=\s*(\w+)`)
+	requestTimeoutRe  = regexp.MustCompile(`request_timeout\s*=\s*([\w.]+)`)
+	maxBandwidthRe    = regexp.MustCompile(`max_bandwidth\s*=\s*([\w./]+)`)
+	jurisdictionRe    = regexp.MustCompile(`jurisdiction\s*=\s*(\w+)`)
+	encryptionKeyRe   = regexp.MustCompile(`encryption_key\s*=\s*([\w+/=]+)`)
+	encryptionFileRe  = regexp.MustCompile(`encryption_key_file\s*=\s*(\S+)`)
 )
 
+// bandwidthString formats a bandwidth in bytes per second for the ~/.r2 configuration file, using
+// the largest unit that represents it exactly.
+func bandwidthString(b int64) string {
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if b%unit.size == 0 {
+			return fmt.Sprintf("%d%s/s", b/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%dB/s", b)
+}
+
 // configString formats a set of Cloudflare R2 credentials into a string that can be written to the
 // ~/.r2 configuration file. Allowing for multiple profiles, each profile is formatted as a section
 // with the profile name in square brackets. The profile name is followed by the account ID, access
-// key ID, and secret access key.
+// key ID, and secret access key, and then by any optional settings the profile has.
 func configString(c pkg.Config) string {
 	configTemplate := "[%s]\naccount_id=%s\naccess_key_id=%s\nsecret_access_key=%s"
-	return fmt.Sprintf(configTemplate, c.Profile, c.AccountID, c.AccessKeyID, c.SecretAccessKey)
+	config := fmt.Sprintf(configTemplate, c.Profile, c.AccountID, c.AccessKeyID, c.SecretAccessKey)
+
+	// Add optional settings
+	if c.RetryMaxAttempts > 0 {
+		config += fmt.Sprintf("\nmax_attempts=%d", c.RetryMaxAttempts)
+	}
+	if c.RetryMode != "" {
+		config += fmt.Sprintf("\nretry_mode=%s", c.RetryMode)
+	}
+	if c.RequestTimeout > 0 {
+		config += fmt.Sprintf("\nrequest_timeout=%s", c.RequestTimeout)
+	}
+	if c.MaxBandwidth > 0 {
+		config += fmt.Sprintf("\nmax_bandwidth=%s", bandwidthString(c.MaxBandwidth))
+	}
+	if c.Jurisdiction != "" {
+		config += fmt.Sprintf("\njurisdiction=%s", c.Jurisdiction)
+	}
+	if c.EncryptionKey != "" {
+		config += fmt.Sprintf("\nencryption_key=%s", c.EncryptionKey)
+	}
+	if c.EncryptionKeyFile != "" {
+		config += fmt.Sprintf("\nencryption_key_file=%s", c.EncryptionKeyFile)
+	}
+
+	return config
 }
 
 // getConfigPath returns the path to the ~/.r2 configuration file, accounting for different
@@ -55,7 +103,7 @@ func getProfile(profileName string) pkg.Config {
 	// If profile exists, return it
 	for _, profile := range profiles {
 		if profile.Profile == profileName {
-			return profile
+			return applyFlagOverrides(profile)
 		}
 	}
 
@@ -63,7 +111,40 @@ func getProfile(profileName string) pkg.Config {
 	profile := getCredentials(profileName)
 	writeConfig(profile)
 
-	return profile
+	return applyFlagOverrides(profile)
+}
+
+// applyFlagOverrides overrides the optional settings of a profile with any global flags set on the
+// command line, so settings can be changed for a single run without editing ~/.r2.
+func applyFlagOverrides(c pkg.Config) pkg.Config {
+	flags := rootCmd.PersistentFlags()
+
+	if flags.Changed("max-attempts") {
+		c.RetryMaxAttempts, _ = flags.GetInt("max-attempts")
+	}
+	if flags.Changed("retry-mode") {
+		c.RetryMode, _ = flags.GetString("retry-mode")
+	}
+	if flags.Changed("request-timeout") {
+		c.RequestTimeout, _ = flags.GetDuration("request-timeout")
+	}
+	if flags.Changed("max-bandwidth") {
+		bandwidth, _ := flags.GetString("max-bandwidth")
+		var err error
+		if c.MaxBandwidth, err = pkg.ParseBandwidth(bandwidth); err != nil {
+			log.Fatalf("Invalid --max-bandwidth value %q: %v", bandwidth, err)
+		}
+	}
+	if flags.Changed("jurisdiction") {
+		c.Jurisdiction, _ = flags.GetString("jurisdiction")
+	}
+	if flags.Changed("encryption-key-file") {
+		// An inline key in the profile would take precedence over the file
+		c.EncryptionKeyFile, _ = flags.GetString("encryption-key-file")
+		c.EncryptionKey = ""
+	}
+
+	return c
 }
 
 // getCredentials prompts the user to enter the Cloudflare R2 credentials for a specified profile.
@@ -152,6 +233,45 @@ func getConfig(createIfNotPresent bool) map[string]pkg.Config {
 			profile.SecretAccessKey = secretAccessKeyRe.FindAllStringSubmatch(p, -1)[0][1]
 		}
 
+		// Get maximum attempts per request
+		if maxAttemptsRe.MatchString(p) {
+			profile.RetryMaxAttempts, _ = strconv.Atoi(maxAttemptsRe.FindAllStringSubmatch(p, -1)[0][1])
+		}
+
+		// Get retry mode
+		if retryModeRe.MatchString(p) {
+			profile.RetryMode = retryModeRe.FindAllStringSubmatch(p, -1)[0][1]
+		}
+
+		// Get request timeout
+		if requestTimeoutRe.MatchString(p) {
+			timeout := requestTimeoutRe.FindAllStringSubmatch(p, -1)[0][1]
+			if profile.RequestTimeout, err = time.ParseDuration(timeout); err != nil {
+				log.Fatalf("Invalid request_timeout %q in profile %s: %v", timeout, profile.Profile, err)
+			}
+		}
+
+		// Get maximum bandwidth
+		if maxBandwidthRe.MatchString(p) {
+			bandwidth := maxBandwidthRe.FindAllStringSubmatch(p, -1)[0][1]
+			if profile.MaxBandwidth, err = pkg.ParseBandwidth(bandwidth); err != nil {
+				log.Fatalf("Invalid max_bandwidth %q in profile %s: %v", bandwidth, profile.Profile, err)
+			}
+		}
+
+		// Get jurisdiction
+		if jurisdictionRe.MatchString(p) {
+			profile.Jurisdiction = jurisdictionRe.FindAllStringSubmatch(p, -1)[0][1]
+		}
+
+		// Get client-side encryption key or key file
+		if encryptionKeyRe.MatchString(p) {
+			profile.EncryptionKey = encryptionKeyRe.FindAllStringSubmatch(p, -1)[0][1]
+		}
+		if encryptionFileRe.MatchString(p) {
+			profile.EncryptionKeyFile = encryptionFileRe.FindAllStringSubmatch(p, -1)[0][1]
+		}
+
 		profiles[profile.Profile] = profile
 	}
 
@@ -195,6 +315,31 @@ func writeConfig(c pkg.Config) {
 		log.Fatal("All credentials must be provided and cannot be empty or contain only whitespace")
 	}
 
+	// Keep optional settings of an existing profile that aren't being changed
+	if existing, ok := profiles[c.Profile]; ok {
+		if c.RetryMaxAttempts == 0 {
+			c.RetryMaxAttempts = existing.RetryMaxAttempts
+		}
+		if c.RetryMode == "" {
+			c.RetryMode = existing.RetryMode
+		}
+		if c.RequestTimeout == 0 {
+			c.RequestTimeout = existing.RequestTimeout
+		}
+		if c.MaxBandwidth == 0 {
+			c.MaxBandwidth = existing.MaxBandwidth
+		}
+		if c.Jurisdiction == "" {
+			c.Jurisdiction = existing.Jurisdiction
+		}
+		if c.EncryptionKey == "" {
+			c.EncryptionKey = existing.EncryptionKey
+		}
+		if c.EncryptionKeyFile == "" {
+			c.EncryptionKeyFile = existing.EncryptionKeyFile
+		}
+	}
+
 	// Add profile to configuration
 	profiles[c.Profile] = c
 
@@ -256,6 +401,20 @@ the --profile flag.
 Profiles are stored in ~/.r2 and can be used by passing the --profile flag to
 any command.
 
+Profiles may also hold optional settings, added by editing ~/.r2:
+
+  max_attempts=5          Maximum attempts per request, including the first
+  retry_mode=adaptive     Retry backoff mode: standard or adaptive
+  request_timeout=30s     Time to wait for a response before retrying
+  max_bandwidth=50MB/s    Bandwidth shared by all uploads and downloads
+  jurisdiction=eu         Jurisdiction of the buckets used: eu or fedramp
+  encryption_key_file=/etc/r2/backup.key
+                          File holding a key to encrypt objects client-side
+  encryption_key=<key>    Client-side encryption key, in base64 or hex
+
+Each setting can be overridden for a single run with the global flag of the
+same name (e.g. --max-attempts).
+
 To list available profiles, run:
   r2 configure --list
 
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// corsCmd represents the cors command
+var corsCmd = &cobra.Command{
+	Use:   "cors",
+	Short: "Manage bucket CORS rules",
+	Long: `Show, replace, remove or test a bucket's CORS rules.
+
+CORS rules let web pages on other origins access a bucket from the browser,
+e.g. to upload with presigned PUT URLs. Rules are written in a JSON or YAML
+rule file:
+
+  rules:
+    - id: browser-uploads
+      allowedOrigins: ["https://app.example.com", "https://*.example.dev"]
+      allowedMethods: [GET, PUT]
+      allowedHeaders: [content-type]
+      exposeHeaders: [etag]
+      maxAgeSeconds: 3600
+
+Origins and headers may contain a single * wildcard. Methods may be GET, PUT,
+POST, DELETE and HEAD.
+
+Examples:
+  # Show a bucket's CORS rules
+  r2 cors get r2://bucket
+
+  # Replace a bucket's CORS rules
+  r2 cors put r2://bucket cors.yaml
+
+  # Check whether a browser upload from an origin would be allowed
+  r2 cors test r2://bucket --origin https://app.example.com --method PUT --header content-type
+
+  # Remove all CORS rules
+  r2 cors rm r2://bucket`,
+}
+
+// corsGetCmd represents the cors get command
+var corsGetCmd = &cobra.Command{
+	Use:   "get r2://bucket",
+	Short: "Show a bucket's CORS rules",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Print rules for people, or as a rule file that can be edited and put back
+		switch output {
+		case "text":
+			err = b.PrintCORS()
+		case "json", "yaml":
+			var config pkg.CORSConfig
+			if config, err = b.GetCORS(); err == nil {
+				err = printConfig(config, output)
+			}
+		default:
+			log.Fatalf("Invalid --output value %q: must be text, json or yaml", output)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't get CORS rules of %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// corsPutCmd represents the cors put command
+var corsPutCmd = &cobra.Command{
+	Use:   "put r2://bucket rules-file",
+	Short: "Replace a bucket's CORS rules with those in a JSON or YAML file",
+	Long: `Replace a bucket's CORS rules with those in a JSON or YAML rule file, or stdin
+if the file is -. The rules are validated before any are applied.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+
+		config, err := pkg.ParseCORSConfig(readConfigFile(args[1]))
+		if err != nil {
+			log.Fatalf("Invalid rule file %s:\n%v\n", args[1], err)
+		}
+		if err := b.PutCORS(config); err != nil {
+			log.Fatalf("Couldn't put CORS rules of %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Applied %d CORS rules to %s\n", len(config.Rules), args[0])
+	},
+}
+
+// corsRmCmd represents the cors rm command
+var corsRmCmd = &cobra.Command{
+	Use:   "rm r2://bucket",
+	Short: "Remove all of a bucket's CORS rules",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+		if err := b.RemoveCORS(); err != nil {
+			log.Fatalf("Couldn't remove CORS rules of %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// corsTestCmd represents the cors test command
+var corsTestCmd = &cobra.Command{
+	Use:   "test r2://bucket --origin origin --method method",
+	Short: "Check whether CORS rules allow a browser request",
+	Long: `Simulate a browser request against a bucket's CORS rules, printing the rule
+that allows it and the CORS headers the response would carry. The request is
+evaluated locally; nothing is sent to the bucket except a request for its
+rules. Pass --file to test the rules in a rule file before putting them.
+
+If no rule allows the request, cors test exits with status 1.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		origin, err := cmd.Flags().GetString("origin")
+		if err != nil {
+			log.Fatal(err)
+		}
+		method, err := cmd.Flags().GetString("method")
+		if err != nil {
+			log.Fatal(err)
+		}
+		headers, err := cmd.Flags().GetStringSlice("header")
+		if err != nil {
+			log.Fatal(err)
+		}
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Get the rules from the rule file or the bucket
+		var config pkg.CORSConfig
+		if file != "" {
+			if config, err = pkg.ParseCORSConfig(readConfigFile(file)); err != nil {
+				log.Fatalf("Invalid rule file %s:\n%v\n", file, err)
+			}
+		} else {
+			b := getConfigBucket(cmd, args[0])
+			if config, err = b.GetCORS(); err != nil {
+				log.Fatalf("Couldn't get CORS rules of %s: %v\n", args[0], err)
+			}
+		}
+
+		rule, response := config.Evaluate(origin, method, headers)
+		if rule == nil {
+			fmt.Fprintf(os.Stderr, "Blocked: no CORS rule allows %s requests from %s", method, origin)
+			if len(headers) > 0 {
+				fmt.Fprintf(os.Stderr, " with headers %v", headers)
+			}
+			fmt.Fprintln(os.Stderr)
+			os.Exit(1)
+		}
+
+		if rule.ID != "" {
+			fmt.Printf("Allowed by rule %q\n", rule.ID)
+		} else {
+			fmt.Println("Allowed")
+		}
+		names := make([]string, 0, len(response))
+		for name := range response {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %s: %s\n", name, response[name])
+		}
+	},
+}
+
+func init() {
+	// Add the cors command and its subcommands to the root command
+	rootCmd.AddCommand(corsCmd)
+	corsCmd.AddCommand(corsGetCmd, corsPutCmd, corsRmCmd, corsTestCmd)
+
+	// Add output format flag
+	corsGetCmd.Flags().StringP("output", "o", "text", "Output format: text, json or yaml")
+
+	// Add simulated request flags
+	corsTestCmd.Flags().String("origin", "", "Origin of the simulated request, e.g. https://app.example.com")
+	corsTestCmd.Flags().String("method", "GET", "HTTP method of the simulated request")
+	corsTestCmd.Flags().StringSlice("header", nil, "Request header of the simulated request (repeatable)")
+	corsTestCmd.Flags().String("file", "", "Test the rules in this rule file instead of the bucket's")
+	corsTestCmd.MarkFlagRequired("origin")
+}
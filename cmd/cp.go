@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"io"
 	"log"
+	"os"
 
 	"github.com/erdos-one/r2/pkg"
 
@@ -12,7 +14,62 @@ import (
 var cpCmd = &cobra.Command{
 	Use:   "cp",
 	Short: "Copy an object from one R2 path to another",
-	Long:  ``,
+	Long: `Copy a local file or R2 object to another location locally or in R2.
+
+Pass - as the destination to write an R2 object to stdout. A byte range of it
+may be written instead with --range, --offset or --tail, as with cat.
+
+--if-match and --if-none-match make uploads and downloads conditional on the
+object's ETag. Pass --if-none-match '*' to only upload if the object doesn't
+exist yet. If a precondition isn't met, cp exits with status 3.
+
+Progress is shown on stderr: a live status line on terminals, or a line per
+completed object otherwise. Pass --quiet to suppress it.
+
+Copies between R2 locations happen server-side, in parallel parts for objects
+larger than 5 GiB. They keep the source object's metadata unless
+--metadata-directive REPLACE is passed, in which case the metadata flags are
+used instead; the metadata flags are refused without it.
+
+Objects encrypted server-side with a customer-provided key (SSE-C) are written
+and read with --sse-c-key or --sse-c-key-file. R2 doesn't store the key, so
+reading an object without its key fails. For copies between R2 locations, the
+key encrypts the destination, and --sse-c-copy-source-key or
+--sse-c-copy-source-key-file gives the source's key.
+
+--compress gzip|zstd compresses uploads, setting their Content-Encoding while
+keeping their name. Objects uploaded with --compress are decompressed when
+downloaded, unless --no-decompress is given; other objects, e.g. pre-compressed
+.gz files, are downloaded as stored.
+
+Examples:
+  # Upload a local file
+  r2 cp report.pdf r2://bucket/reports/report.pdf
+
+  # Download an object
+  r2 cp r2://bucket/reports/report.pdf report.pdf
+
+  # Copy an object between buckets
+  r2 cp r2://bucket/reports/report.pdf r2://archive/report.pdf
+
+  # Copy an object, replacing its metadata
+  r2 cp r2://bucket/page.html r2://bucket/page-v2.html \
+    --metadata-directive REPLACE --cache-control "max-age=60"
+
+  # Upload a file only if no object exists at the destination
+  r2 cp release.json r2://bucket/releases/v1.json --if-none-match '*'
+
+  # Replace an object only if it hasn't changed since it was read
+  r2 cp state.json r2://bucket/state.json --if-match '"5d41402abc4b2a76b9719d911017c592"'
+
+  # Upload a file encrypted with an SSE-C key
+  r2 cp secrets.db r2://bucket/secrets.db --sse-c-key-file ./sse.key
+
+  # Write an object to stdout
+  r2 cp r2://bucket/data.csv.gz - | zcat
+
+  # Write the last 4096 bytes of an object to stdout
+  r2 cp r2://logs/huge.log - --tail 4096`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get profile client
 		profileName, err := cmd.Flags().GetString("profile")
@@ -21,6 +78,31 @@ var cpCmd = &cobra.Command{
 		}
 		c := pkg.Client(getProfile(profileName))
 
+		// Report progress unless quiet
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			log.Fatal(err)
+		}
+		display := newProgressDisplay()
+		progress := display.progressFunc(quiet)
+
+		// Get preconditions for conditional transfers
+		ifMatch, ifNoneMatch := getConditions(cmd)
+		getOpts := pkg.GetOptions{IfMatch: ifMatch, IfNoneMatch: ifNoneMatch}
+		if getOpts.NoDecompress, err = cmd.Flags().GetBool("no-decompress"); err != nil {
+			log.Fatal(err)
+		}
+
+		// Get SSE-C keys of objects encrypted server-side
+		sseKey := getSSECustomerKey(cmd, "sse-c-key")
+		getOpts.SSECustomerKey = sseKey
+
+		// Byte ranges can only be written to stdout
+		getOpts.Range = getRange(cmd)
+		if getOpts.Range != "" && (len(args) != 2 || args[1] != "-") {
+			log.Fatal("--range, --offset and --tail are only supported when writing to stdout (-).")
+		}
+
 		// If a bucket name is provided, create the bucket
 		if len(args) == 2 {
 			sourcePath := args[0]
@@ -29,18 +111,52 @@ var cpCmd = &cobra.Command{
 				// Copy local file to R2
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(destURI.Bucket)
-				b.Upload(sourcePath, destURI.Path)
+				opts := getPutOptions(cmd)
+				opts.IfMatch, opts.IfNoneMatch = ifMatch, ifNoneMatch
+				opts.SSECustomerKey = sseKey
+				opts.Progress = progress
+				err = b.UploadWithOptions(sourcePath, destURI.Path, opts)
+				display.finish()
+				if err != nil {
+					fatalTransferError(err)
+				}
+			} else if pkg.IsR2URI(sourcePath) && destinationPath == "-" {
+				// Copy R2 object to stdout
+				sourceURI := pkg.ParseR2URISafe(sourcePath)
+				b := c.Bucket(sourceURI.Bucket)
+				body, err := b.GetWithOptions(sourceURI.Path, getOpts)
+				if err != nil {
+					fatalTransferError(err)
+				}
+				defer body.Close()
+				if _, err := io.Copy(os.Stdout, body); err != nil {
+					log.Fatalf("Couldn't stream file r2://%s/%s: %v\n", sourceURI.Bucket, sourceURI.Path, err)
+				}
 			} else if pkg.IsR2URI(sourcePath) && !pkg.IsR2URI(destinationPath) {
 				// Copy R2 object to local file
 				sourceURI := pkg.ParseR2URISafe(sourcePath)
 				b := c.Bucket(sourceURI.Bucket)
-				b.Download(sourceURI.Path, destinationPath)
+				getOpts.Progress = progress
+				err = b.DownloadWithOptions(sourceURI.Path, destinationPath, getOpts)
+				display.finish()
+				if err != nil {
+					fatalTransferError(err)
+				}
 			} else if pkg.IsR2URI(sourcePath) && pkg.IsR2URI(destinationPath) {
 				// Copy R2 object to R2 object
 				sourceURI := pkg.ParseR2URISafe(sourcePath)
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(sourceURI.Bucket)
-				b.Copy(sourceURI.Path, destURI)
+				opts := getCopyOptions(cmd)
+				opts.Put.IfMatch, opts.Put.IfNoneMatch = ifMatch, ifNoneMatch
+				opts.Put.SSECustomerKey = sseKey
+				opts.SourceSSECustomerKey = getSSECustomerKey(cmd, "sse-c-copy-source-key")
+				opts.Put.Progress = progress
+				err = b.CopyWithOptions(sourceURI.Path, destURI, opts)
+				display.finish()
+				if err != nil {
+					log.Fatal(err)
+				}
 			}
 		} else {
 			log.Fatal("Please provide both a source and destination path.")
@@ -51,4 +167,19 @@ var cpCmd = &cobra.Command{
 func init() {
 	// Add the cp command to the root command
 	rootCmd.AddCommand(cpCmd)
+
+	// Add progress flag
+	cpCmd.Flags().BoolP("quiet", "q", false, "Suppress progress output")
+
+	// Add flags for conditional transfers
+	addConditionFlags(cpCmd)
+
+	// Add range flags for writing to stdout
+	addRangeFlags(cpCmd)
+	cpCmd.Flags().Bool("no-decompress", false, "Download objects compressed with --compress as stored")
+
+	// Add flags for written object metadata, copies and SSE-C keys
+	addCopyFlags(cpCmd)
+	addPutFlags(cpCmd)
+	addSSECustomerKeyFlags(cpCmd, true)
 }
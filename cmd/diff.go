@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff SRC DST",
+	Short: "Compare two locations without transferring anything",
+	Long: `Compare a local directory and an R2 prefix, or two R2 prefixes, using the same
+comparison as sync, without transferring anything.
+
+Paths only in the source are marked with +, paths only in the destination with
+-, and changed paths with ~, followed by the reason they differ: size, hash, or
+mtime when either side was uploaded in multiple parts, so hashes can't be
+compared, and the source is newer.
+
+diff exits with status 0 when the locations match and 5 when they differ, so
+it can be used to check a deployment in CI.
+
+Examples:
+  # Show what a sync of a local directory would upload
+  r2 diff ./site r2://bucket/site
+
+  # Check that two buckets hold the same objects
+  r2 diff r2://bucket/data r2://replica/data
+
+  # Show the differences as JSON
+  r2 diff ./site r2://bucket/site -o json`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if output != "text" && output != "json" {
+			log.Fatalf("Invalid --output value %q: must be text or json", output)
+		}
+
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		sourcePath, destinationPath := args[0], args[1]
+		var entries []pkg.DiffEntry
+		switch {
+		case !pkg.IsR2URI(sourcePath) && pkg.IsR2URI(destinationPath):
+			destURI := pkg.ParseR2URISafe(destinationPath)
+			b := c.Bucket(destURI.Bucket)
+			entries, err = b.DiffLocalToR2(sourcePath, destURI.Path)
+		case pkg.IsR2URI(sourcePath) && !pkg.IsR2URI(destinationPath):
+			sourceURI := pkg.ParseR2URISafe(sourcePath)
+			b := c.Bucket(sourceURI.Bucket)
+			entries, err = b.DiffR2ToLocal(destinationPath, sourceURI.Path)
+		case pkg.IsR2URI(sourcePath) && pkg.IsR2URI(destinationPath):
+			sourceURI := pkg.ParseR2URISafe(sourcePath)
+			destURI := pkg.ParseR2URISafe(destinationPath)
+			b := c.Bucket(sourceURI.Bucket)
+			entries, err = b.DiffR2ToR2(c.Bucket(destURI.Bucket), sourceURI.Path, destURI.Path)
+		default:
+			log.Fatal("Local-to-local diff is not supported. At least one path must be an R2 URI (r2://bucket/path).")
+		}
+		if err != nil {
+			log.Fatalf("Couldn't compare %s and %s: %v\n", sourcePath, destinationPath, err)
+		}
+
+		if output == "json" {
+			if entries == nil {
+				entries = []pkg.DiffEntry{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(entries); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			pkg.PrintDiff(entries)
+		}
+
+		if len(entries) > 0 {
+			os.Exit(exitDiffers)
+		}
+	},
+}
+
+func init() {
+	// Add the diff command to the root command
+	rootCmd.AddCommand(diffCmd)
+
+	// Add output format flag
+	diffCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+}
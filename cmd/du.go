@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// duCmd represents the du command
+var duCmd = &cobra.Command{
+	Use:   "du r2://bucket[/prefix/] [r2://bucket[/prefix/]...]",
+	Short: "Show the storage used by each prefix of a bucket",
+	Long: `Show the number of objects and total size under each prefix of a bucket.
+
+Usage is aggregated for every "directory" (key prefix ending in /) up to --depth
+levels below the given prefix, sorted by size, followed by the total for the
+prefix itself. Sizes are also split by storage class.
+
+Objects are listed a page at a time, so du works on buckets of any size, but it
+lists every object under the prefix, which can take a while.
+
+Examples:
+  # Show the total usage of a bucket
+  r2 du r2://bucket --depth 0
+
+  # Show the usage of each top-level prefix of a bucket
+  r2 du r2://bucket
+
+  # Show the usage of two levels of prefixes under logs/
+  r2 du r2://bucket/logs/ --depth 2`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		depth, err := cmd.Flags().GetInt("depth")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if depth < 0 {
+			log.Fatalf("Invalid --depth value %d: must be 0 or more", depth)
+		}
+
+		// Show usage of each location passed
+		for _, arg := range args {
+			uri := pkg.ParseR2URISafe(arg)
+			b := c.Bucket(uri.Bucket)
+			if err := b.PrintDiskUsage(uri.Path, depth); err != nil {
+				log.Fatalf("Couldn't get usage of %s: %v\n", arg, err)
+			}
+		}
+	},
+}
+
+func init() {
+	// Add the du command to the root command
+	rootCmd.AddCommand(duCmd)
+
+	// Add depth flag
+	duCmd.Flags().IntP("depth", "d", 1, "Number of prefix levels to show below the given prefix")
+}
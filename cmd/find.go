@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// findCmd represents the find command
+var findCmd = &cobra.Command{
+	Use:   "find r2://bucket[/prefix]",
+	Short: "Find objects by name, size, age and metadata",
+	Long: `Find the objects under a prefix matching all of the given predicates.
+
+--name matches the last path element of each key against a glob. --size takes
++N for objects larger than N, -N for objects smaller than N, or N for objects
+of exactly N bytes, with optional units (e.g. +1G, -10M). --older-than and
+--newer-than take an age (e.g. 12h, 30d, 2w) or a date (e.g. 2024-06-01).
+--metadata key=glob matches user metadata; it costs a request per candidate
+object, so combine it with cheaper predicates where possible.
+
+Matching objects are printed as R2 URIs, one per line, or separated by NUL
+characters with --print0 for use with xargs -0. Instead of printing them,
+--exec-rm deletes them and --exec-cp copies them to another location, keeping
+their paths relative to the searched prefix.
+
+Examples:
+  # Parquet files under data/ larger than 1 GiB, last modified before June
+  r2 find r2://bucket/data/ --name '*.parquet' --size +1G --older-than 2024-06-01
+
+  # Logs modified in the last day
+  r2 find r2://bucket/logs/ --newer-than 1d
+
+  # Objects uploaded by a particular job
+  r2 find r2://bucket --metadata job=nightly-*
+
+  # Delete temporary files older than a week
+  r2 find r2://bucket/tmp/ --older-than 1w --exec-rm
+
+  # Archive old reports to another bucket
+  r2 find r2://bucket/reports/ --older-than 90d --exec-cp r2://archive/reports/
+
+  # Feed results to another command
+  r2 find r2://bucket --name '*.tmp' --print0 | xargs -0 r2 rm`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := getFindOptions(cmd)
+
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		if !pkg.IsR2URI(args[0]) {
+			log.Fatalf("Path %s is not a valid R2 URI", args[0])
+		}
+		uri := pkg.ParseR2URISafe(args[0])
+		b := c.Bucket(uri.Bucket)
+
+		action := getFindAction(cmd, b, uri.Path)
+
+		if err := b.Find(uri.Path, opts, action); err != nil {
+			log.Fatalf("Couldn't search %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// getFindOptions parses the predicate flags of the find command into a pkg.FindOptions struct.
+// Invalid values terminate the program.
+func getFindOptions(cmd *cobra.Command) pkg.FindOptions {
+	var opts pkg.FindOptions
+	var err error
+
+	if opts.Name, err = cmd.Flags().GetString("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	// Parse size bound, e.g. +1G, -10M or 512
+	size, err := cmd.Flags().GetString("size")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if size != "" {
+		if opts.LargerThan, opts.SmallerThan, err = pkg.ParseSizeBound(size); err != nil {
+			log.Fatalf("Invalid --size value %q: %v", size, err)
+		}
+	}
+
+	// Parse age bounds
+	olderThan, err := cmd.Flags().GetString("older-than")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if olderThan != "" {
+		if opts.ModifiedBefore, err = pkg.ParseAge(olderThan); err != nil {
+			log.Fatalf("Invalid --older-than value: %v", err)
+		}
+	}
+	newerThan, err := cmd.Flags().GetString("newer-than")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if newerThan != "" {
+		if opts.ModifiedAfter, err = pkg.ParseAge(newerThan); err != nil {
+			log.Fatalf("Invalid --newer-than value: %v", err)
+		}
+	}
+
+	// Parse storage class
+	storageClass, err := cmd.Flags().GetString("storage-class")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if storageClass != "" {
+		if opts.StorageClass, err = pkg.ParseStorageClass(storageClass); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Parse key=glob metadata predicates
+	metadata, err := cmd.Flags().GetStringArray("metadata")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, pair := range metadata {
+		key, pattern, _ := strings.Cut(pair, "=")
+		if key == "" {
+			log.Fatalf("Invalid --metadata value %q: must be in the form key=glob or key", pair)
+		}
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]string)
+		}
+		opts.Metadata[key] = pattern
+	}
+
+	if err := opts.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	return opts
+}
+
+// getFindAction returns the function the find command applies to each matching object, as chosen by
+// its action flags. Objects are printed unless another action is chosen. prefix is the searched
+// prefix, which copied objects' paths are made relative to.
+func getFindAction(cmd *cobra.Command, b pkg.R2Bucket, prefix string) func(types.Object) error {
+	print0, err := cmd.Flags().GetBool("print0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	execRm, err := cmd.Flags().GetBool("exec-rm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	execCp, err := cmd.Flags().GetString("exec-cp")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if execRm && execCp != "" {
+		log.Fatal("Please pass only one of --exec-rm and --exec-cp.")
+	}
+
+	// Copied objects keep their paths relative to the searched "directory"
+	base := prefix[:strings.LastIndex(prefix, "/")+1]
+
+	switch {
+	case execRm:
+		return func(object types.Object) error {
+			if err := b.DeleteObject(*object.Key); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted r2://%s/%s\n", b.Name, *object.Key)
+			return nil
+		}
+	case pkg.IsR2URI(execCp):
+		dest := pkg.ParseR2URISafe(execCp)
+		return func(object types.Object) error {
+			target := pkg.R2URI{Bucket: dest.Bucket, Path: path.Join(dest.Path, strings.TrimPrefix(*object.Key, base))}
+			if err := b.CopyWithOptions(*object.Key, target, pkg.CopyOptions{}); err != nil {
+				return err
+			}
+			fmt.Printf("Copied r2://%s/%s to r2://%s/%s\n", b.Name, *object.Key, target.Bucket, target.Path)
+			return nil
+		}
+	case execCp != "":
+		return func(object types.Object) error {
+			// Refuse keys that would be written outside of the destination directory
+			relativePath := filepath.FromSlash(strings.TrimPrefix(*object.Key, base))
+			if !filepath.IsLocal(relativePath) {
+				fmt.Fprintf(os.Stderr, "Skipping r2://%s/%s: path escapes the destination directory\n", b.Name, *object.Key)
+				return nil
+			}
+			localPath := filepath.Join(execCp, relativePath)
+			if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+				return err
+			}
+			if err := b.DownloadWithOptions(*object.Key, localPath, pkg.GetOptions{}); err != nil {
+				return err
+			}
+			fmt.Printf("Copied r2://%s/%s to %s\n", b.Name, *object.Key, localPath)
+			return nil
+		}
+	default:
+		terminator := "\n"
+		if print0 {
+			terminator = "\x00"
+		}
+		return func(object types.Object) error {
+			fmt.Printf("r2://%s/%s%s", b.Name, *object.Key, terminator)
+			return nil
+		}
+	}
+}
+
+func init() {
+	// Add the find command to the root command
+	rootCmd.AddCommand(findCmd)
+
+	// Add predicate flags
+	findCmd.Flags().String("name", "", "Glob matched against the last path element of each key, e.g. '*.parquet'")
+	findCmd.Flags().String("size", "", "Size bound: +N larger than, -N smaller than, or exactly N bytes (e.g. +1G)")
+	findCmd.Flags().String("older-than", "", "Only objects last modified before an age (e.g. 30d) or date (e.g. 2024-06-01)")
+	findCmd.Flags().String("newer-than", "", "Only objects last modified after an age (e.g. 1d) or date (e.g. 2024-06-01)")
+	findCmd.Flags().String("storage-class", "", "Only objects in a storage class (Standard or InfrequentAccess)")
+	findCmd.Flags().StringArray("metadata", nil, "User metadata predicate as key=glob, or key to require it (repeatable)")
+
+	// Add action flags
+	findCmd.Flags().Bool("print0", false, "Separate printed URIs with NUL characters instead of newlines")
+	findCmd.Flags().Bool("exec-rm", false, "Delete matching objects instead of printing them")
+	findCmd.Flags().String("exec-cp", "", "Copy matching objects to an R2 URI or local directory instead of printing them")
+}
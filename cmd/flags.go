@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// addPutFlags adds the flags controlling the metadata of uploaded objects to a command. The flags
+// are parsed into a pkg.PutOptions struct by getPutOptions.
+func addPutFlags(cmd *cobra.Command) {
+	cmd.Flags().String("content-type", "", "Content-Type of uploaded objects (detected from the extension or contents if unset)")
+	cmd.Flags().String("cache-control", "", "Cache-Control header of uploaded objects")
+	cmd.Flags().String("content-encoding", "", "Content-Encoding header of uploaded objects")
+	cmd.Flags().String("content-disposition", "", "Content-Disposition header of uploaded objects")
+	cmd.Flags().String("expires", "", "Expires header of uploaded objects, as an RFC 3339 timestamp")
+	cmd.Flags().StringArray("metadata", nil, "User metadata of uploaded objects as key=value (repeatable)")
+	cmd.Flags().String("storage-class", "", "Storage class of written objects (Standard or InfrequentAccess)")
+	cmd.Flags().String("checksum-algorithm", "", "Checksum sent with uploads and stored with objects: CRC32, CRC32C, SHA1 or SHA256")
+	cmd.Flags().String("compress", "", "Compress uploaded objects with gzip or zstd, setting their Content-Encoding")
+}
+
+// getPutOptions parses the flags added by addPutFlags into a pkg.PutOptions struct. Invalid values
+// terminate the program.
+func getPutOptions(cmd *cobra.Command) pkg.PutOptions {
+	var opts pkg.PutOptions
+	var err error
+
+	if opts.ContentType, err = cmd.Flags().GetString("content-type"); err != nil {
+		log.Fatal(err)
+	}
+	if opts.CacheControl, err = cmd.Flags().GetString("cache-control"); err != nil {
+		log.Fatal(err)
+	}
+	if opts.ContentEncoding, err = cmd.Flags().GetString("content-encoding"); err != nil {
+		log.Fatal(err)
+	}
+	if opts.ContentDisposition, err = cmd.Flags().GetString("content-disposition"); err != nil {
+		log.Fatal(err)
+	}
+
+	// Parse expiry timestamp
+	expires, err := cmd.Flags().GetString("expires")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if expires != "" {
+		t, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			log.Fatalf("Invalid --expires value %q: must be an RFC 3339 timestamp (e.g. 2030-01-02T15:04:05Z)", expires)
+		}
+		opts.Expires = &t
+	}
+
+	// Parse key=value metadata pairs
+	metadata, err := cmd.Flags().GetStringArray("metadata")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, pair := range metadata {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			log.Fatalf("Invalid --metadata value %q: must be in the form key=value", pair)
+		}
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]string)
+		}
+		opts.Metadata[key] = value
+	}
+
+	// Parse storage class
+	storageClass, err := cmd.Flags().GetString("storage-class")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if storageClass != "" {
+		if opts.StorageClass, err = pkg.ParseStorageClass(storageClass); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Parse checksum algorithm
+	checksumAlgorithm, err := cmd.Flags().GetString("checksum-algorithm")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if checksumAlgorithm != "" {
+		if opts.ChecksumAlgorithm, err = pkg.ParseChecksumAlgorithm(checksumAlgorithm); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Parse compression
+	compress, err := cmd.Flags().GetString("compress")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if compress != "" {
+		if opts.Compress, err = pkg.ParseCompression(compress); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return opts
+}
+
+// metadataFlags are the flags added by addPutFlags that set object metadata.
+var metadataFlags = []string{"content-type", "cache-control", "content-encoding", "content-disposition", "expires", "metadata"}
+
+// addCopyFlags adds the flags controlling R2-to-R2 copies to a command. The command must also have
+// the flags added by addPutFlags. The flags are parsed into a pkg.CopyOptions struct by
+// getCopyOptions.
+func addCopyFlags(cmd *cobra.Command) {
+	cmd.Flags().String("metadata-directive", "COPY", "Whether R2-to-R2 copies keep the source's metadata (COPY) or use the metadata flags (REPLACE)")
+}
+
+// getCopyOptions parses the flags added by addPutFlags and addCopyFlags into a pkg.CopyOptions
+// struct. Invalid values terminate the program.
+func getCopyOptions(cmd *cobra.Command) pkg.CopyOptions {
+	directive, err := cmd.Flags().GetString("metadata-directive")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := pkg.CopyOptions{Put: getPutOptions(cmd)}
+	switch strings.ToUpper(directive) {
+	case "COPY":
+		opts.MetadataDirective = types.MetadataDirectiveCopy
+	case "REPLACE":
+		opts.MetadataDirective = types.MetadataDirectiveReplace
+	default:
+		log.Fatalf("Invalid --metadata-directive value %q: must be COPY or REPLACE", directive)
+	}
+
+	// Copies keep the source's metadata unless it's replaced, which would ignore the metadata flags
+	if opts.MetadataDirective == types.MetadataDirectiveCopy {
+		for _, name := range metadataFlags {
+			if cmd.Flags().Changed(name) {
+				log.Fatalf("--%s only applies to R2-to-R2 copies with --metadata-directive REPLACE", name)
+			}
+		}
+	}
+
+	return opts
+}
+
+// addSSECustomerKeyFlags adds the flags supplying a key for server-side encryption with
+// customer-provided keys (SSE-C) to a command. If copySource is set, flags supplying the key of the
+// source of copies between R2 locations are added too. The keys are read by getSSECustomerKey.
+func addSSECustomerKeyFlags(cmd *cobra.Command, copySource bool) {
+	cmd.Flags().String("sse-c-key", "", "SSE-C key objects are encrypted with server-side, as 32 bytes in base64 or hex")
+	cmd.Flags().String("sse-c-key-file", "", "File holding the SSE-C key objects are encrypted with server-side")
+	if copySource {
+		cmd.Flags().String("sse-c-copy-source-key", "", "SSE-C key the source of R2-to-R2 copies is encrypted with, as 32 bytes in base64 or hex")
+		cmd.Flags().String("sse-c-copy-source-key-file", "", "File holding the SSE-C key the source of R2-to-R2 copies is encrypted with")
+	}
+}
+
+// getSSECustomerKey returns the SSE-C key given with the flag of the given name or its -file
+// variant, as added by addSSECustomerKeyFlags, or nil if neither was given. Invalid keys terminate
+// the program.
+func getSSECustomerKey(cmd *cobra.Command, name string) []byte {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	file, err := cmd.Flags().GetString(name + "-file")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case value != "" && file != "":
+		log.Fatalf("Only one of --%s and --%s-file may be used at a time", name, name)
+	case value != "":
+		key, err := pkg.ParseEncryptionKey(value)
+		if err != nil {
+			log.Fatalf("Invalid --%s value: %v", name, err)
+		}
+		return key
+	case file != "":
+		key, err := pkg.LoadEncryptionKey(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return key
+	}
+	return nil
+}
+
+// addRangeFlags adds the flags requesting a byte range of an object to a command. The range is
+// built by getRange.
+func addRangeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("range", "", "Byte range to fetch, e.g. bytes=0-1023")
+	cmd.Flags().Int64("offset", 0, "Fetch everything from this byte offset onwards")
+	cmd.Flags().Int64("tail", 0, "Fetch only the last N bytes")
+}
+
+// getRange builds the byte range requested by the flags added by addRangeFlags. An empty string is
+// returned if no range was requested.
+func getRange(cmd *cobra.Command) string {
+	byteRange, err := cmd.Flags().GetString("range")
+	if err != nil {
+		log.Fatal(err)
+	}
+	offset, err := cmd.Flags().GetInt64("offset")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tail, err := cmd.Flags().GetInt64("tail")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Only one way of specifying the range may be used at a time
+	set := 0
+	for _, name := range []string{"range", "offset", "tail"} {
+		if cmd.Flags().Changed(name) {
+			set++
+		}
+	}
+	if set > 1 {
+		log.Fatal("Only one of --range, --offset and --tail may be used at a time")
+	}
+
+	switch {
+	case cmd.Flags().Changed("offset"):
+		if offset < 0 {
+			log.Fatal("--offset must not be negative")
+		}
+		return pkg.ByteRange(offset, 0)
+	case cmd.Flags().Changed("tail"):
+		if tail <= 0 {
+			log.Fatal("--tail must be positive")
+		}
+		return pkg.ByteRange(-tail, 0)
+	case byteRange != "" && !strings.HasPrefix(byteRange, "bytes="):
+		// Allow the unit to be omitted, e.g. --range 0-1023
+		return "bytes=" + byteRange
+	default:
+		return byteRange
+	}
+}
+
+// addConditionFlags adds the flags making a command's reads and writes conditional to a command.
+func addConditionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("if-match", "", "Only transfer if the existing object's ETag matches")
+	cmd.Flags().String("if-none-match", "", "Only transfer if the object's ETag doesn't match ('*' to only create new objects)")
+}
+
+// getConditions returns the values of the flags added by addConditionFlags.
+func getConditions(cmd *cobra.Command) (ifMatch, ifNoneMatch string) {
+	ifMatch, err := cmd.Flags().GetString("if-match")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ifNoneMatch, err = cmd.Flags().GetString("if-none-match")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ifMatch, ifNoneMatch
+}
+
+// fatalTransferError terminates the program after a failed transfer. Unmet preconditions exit with
+// a distinct status, so scripts using conditional transfers can tell them apart from other errors.
+func fatalTransferError(err error) {
+	if pkg.IsPreconditionFailed(err) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitPreconditionFailed)
+	}
+	log.Fatal(err)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// lifecycleCmd represents the lifecycle command
+var lifecycleCmd = &cobra.Command{
+	Use:   "lifecycle",
+	Short: "Manage bucket lifecycle rules",
+	Long: `Show, replace or remove a bucket's lifecycle rules.
+
+Lifecycle rules delete objects after a number of days or on a date, move them
+to the Infrequent Access storage class, or abort incomplete multipart uploads.
+Rules are written in a JSON or YAML rule file:
+
+  rules:
+    - id: expire-logs
+      prefix: logs/
+      expireAfterDays: 30
+      transitionAfterDays: 7
+    - id: abort-uploads
+      abortIncompleteUploadsAfterDays: 1
+    - id: end-of-campaign
+      prefix: campaigns/2024/
+      expireOn: 2025-01-01
+      enabled: false
+
+Each rule needs an id and at least one action. Rules without a prefix apply to
+every object in the bucket.
+
+Examples:
+  # Show a bucket's lifecycle rules
+  r2 lifecycle get r2://bucket
+
+  # Replace a bucket's lifecycle rules
+  r2 lifecycle put r2://bucket rules.yaml
+
+  # Edit the current rules
+  r2 lifecycle get r2://bucket -o yaml > rules.yaml
+  $EDITOR rules.yaml
+  r2 lifecycle put r2://bucket rules.yaml
+
+  # Remove all lifecycle rules
+  r2 lifecycle rm r2://bucket`,
+}
+
+// lifecycleGetCmd represents the lifecycle get command
+var lifecycleGetCmd = &cobra.Command{
+	Use:   "get r2://bucket",
+	Short: "Show a bucket's lifecycle rules",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Print rules for people, or as a rule file that can be edited and put back
+		switch output {
+		case "text":
+			err = b.PrintLifecycle()
+		case "json", "yaml":
+			var config pkg.LifecycleConfig
+			if config, err = b.GetLifecycle(); err == nil {
+				err = printConfig(config, output)
+			}
+		default:
+			log.Fatalf("Invalid --output value %q: must be text, json or yaml", output)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't get lifecycle rules of %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// lifecyclePutCmd represents the lifecycle put command
+var lifecyclePutCmd = &cobra.Command{
+	Use:   "put r2://bucket rules-file",
+	Short: "Replace a bucket's lifecycle rules with those in a JSON or YAML file",
+	Long: `Replace a bucket's lifecycle rules with those in a JSON or YAML rule file, or
+stdin if the file is -. The rules are validated before any are applied.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+
+		config, err := pkg.ParseLifecycleConfig(readConfigFile(args[1]))
+		if err != nil {
+			log.Fatalf("Invalid rule file %s:\n%v\n", args[1], err)
+		}
+		if err := b.PutLifecycle(config); err != nil {
+			log.Fatalf("Couldn't put lifecycle rules of %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Applied %d lifecycle rules to %s\n", len(config.Rules), args[0])
+	},
+}
+
+// lifecycleRmCmd represents the lifecycle rm command
+var lifecycleRmCmd = &cobra.Command{
+	Use:   "rm r2://bucket",
+	Short: "Remove all of a bucket's lifecycle rules",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b := getConfigBucket(cmd, args[0])
+		if err := b.RemoveLifecycle(); err != nil {
+			log.Fatalf("Couldn't remove lifecycle rules of %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// getConfigBucket returns the bucket named by a bucket configuration command's argument, which may
+// be a bucket name or an R2 URI.
+func getConfigBucket(cmd *cobra.Command, arg string) pkg.R2Bucket {
+	// Get profile client
+	profileName, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := pkg.Client(getProfile(profileName))
+
+	uri := pkg.ParseR2URISafe(arg)
+	if uri.Path != "" {
+		log.Fatalf("Please provide a bucket rather than an object: r2://%s", uri.Bucket)
+	}
+	return c.Bucket(uri.Bucket)
+}
+
+// readConfigFile reads a bucket configuration file, or stdin if the path is -.
+func readConfigFile(path string) []byte {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatalf("Couldn't read %s: %v\n", path, err)
+	}
+	return data
+}
+
+// printConfig prints a bucket configuration as JSON or YAML.
+func printConfig(config any, format string) error {
+	if format == "yaml" {
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(config)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(config)
+}
+
+func init() {
+	// Add the lifecycle command and its subcommands to the root command
+	rootCmd.AddCommand(lifecycleCmd)
+	lifecycleCmd.AddCommand(lifecycleGetCmd, lifecyclePutCmd, lifecycleRmCmd)
+
+	// Add output format flag
+	lifecycleGetCmd.Flags().StringP("output", "o", "text", "Output format: text, json or yaml")
+}
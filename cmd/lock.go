@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Coordinate hosts with a lock stored in R2",
+	Long: `Acquire, release or run a command under a distributed lock stored in R2.
+
+A lock is a lease object at an R2 URI, recording its owner and expiry time.
+Leases are created with If-None-Match and changed with If-Match, so only one
+owner can hold a lock at a time. A lease that has expired may be taken over by
+any owner, so holders must renew their lease before it expires; lock run does
+this automatically.
+
+If a lock is held by another owner, lock commands exit with status 4.
+
+Owners default to a name unique to each invocation, made of the host name,
+process ID and a random suffix, so overlapping invocations on the same host
+exclude each other too. A lease is only taken over before it expires by the
+invocation that acquired it, or with --reentrant by any invocation passing the
+same --owner. lock release needs the --owner the lock was acquired with.
+
+Hosts sharing a lock should have reasonably synchronized clocks, since lease
+expiry times are set by the host writing them.
+
+Examples:
+  # Run a sync on only one of several cron hosts at a time
+  r2 lock run r2://bucket/locks/sync -- r2 sync ./data r2://bucket/data
+
+  # Wait up to 10 minutes for the lock, holding it for 5 minutes at a time
+  r2 lock run r2://bucket/locks/sync --wait 10m --ttl 5m -- ./backup.sh
+
+  # Acquire and release a lock around several commands
+  r2 lock acquire r2://bucket/locks/deploy --ttl 30m --owner "deploy-$$"
+  ./deploy.sh
+  r2 lock release r2://bucket/locks/deploy --owner "deploy-$$"`,
+}
+
+// lockAcquireCmd represents the lock acquire command
+var lockAcquireCmd = &cobra.Command{
+	Use:   "acquire r2://bucket/key",
+	Short: "Acquire a lock, holding it until it's released or its TTL passes",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		lock := getLock(cmd, args[0])
+		acquireLock(cmd, lock)
+		fmt.Printf("Acquired %s as %s until %s\n", args[0], lock.Owner, time.Now().Add(lock.TTL).Format(time.RFC3339))
+	},
+}
+
+// lockReleaseCmd represents the lock release command
+var lockReleaseCmd = &cobra.Command{
+	Use:   "release r2://bucket/key",
+	Short: "Release a lock held by an owner",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !cmd.Flags().Changed("owner") {
+			log.Fatal("Please pass the --owner the lock was acquired with.")
+		}
+
+		// The lease was acquired by another invocation, so release it by its owner
+		lock := getLock(cmd, args[0])
+		lock.Reentrant = true
+		err := lock.Release()
+		if errors.Is(err, pkg.ErrLockLost) {
+			fmt.Fprintf(os.Stderr, "%s is not held by %s\n", args[0], lock.Owner)
+			os.Exit(exitLockHeld)
+		} else if err != nil {
+			log.Fatalf("Couldn't release %s: %v\n", args[0], err)
+		}
+	},
+}
+
+// lockRunCmd represents the lock run command
+var lockRunCmd = &cobra.Command{
+	Use:   "run r2://bucket/key -- command [args...]",
+	Short: "Run a command while holding a lock",
+	Long: `Acquire a lock, run a command while renewing the lock's lease, then release it.
+
+The lease is renewed every third of its TTL. If the lease is lost, e.g. because
+renewals failed for longer than the TTL, the command is killed. Once the
+command exits, the lock is released and lock run exits with the command's exit
+status.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.ArgsLenAtDash() != 1 {
+			log.Fatal("Please provide the lock's R2 URI, followed by -- and the command to run.")
+		}
+		lock := getLock(cmd, args[0])
+		acquireLock(cmd, lock)
+
+		// Start the command with this process's standard streams
+		child := exec.Command(args[1], args[2:]...)
+		child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := child.Start(); err != nil {
+			lock.Release()
+			log.Fatalf("Couldn't run %s: %v\n", args[1], err)
+		}
+
+		// Forward interrupts to the command, so the lock is still released when it exits
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			for sig := range signals {
+				child.Process.Signal(sig)
+			}
+		}()
+
+		// Renew the lease until the command exits, killing the command if the lease is lost
+		stop := make(chan struct{})
+		renewed := make(chan bool)
+		go func() {
+			renewed <- renewLock(lock, child.Process, stop)
+		}()
+
+		waitErr := child.Wait()
+		close(stop)
+		held := <-renewed
+		signal.Stop(signals)
+
+		if !held {
+			fmt.Fprintf(os.Stderr, "Lost %s while running %s\n", args[0], args[1])
+			os.Exit(exitLockHeld)
+		}
+		if err := lock.Release(); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't release %s: %v\n", args[0], err)
+		}
+
+		// Exit with the command's status
+		var exitErr *exec.ExitError
+		if errors.As(waitErr, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		} else if waitErr != nil {
+			log.Fatal(waitErr)
+		}
+	},
+}
+
+// getLock returns the lock at an R2 URI, configured by the flags added in init.
+func getLock(cmd *cobra.Command, uri string) *pkg.Lock {
+	// Get profile client
+	profileName, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := pkg.Client(getProfile(profileName))
+
+	if !pkg.IsR2URI(uri) {
+		log.Fatalf("Path %s is not a valid R2 URI", uri)
+	}
+	lockURI := pkg.ParseR2URISafe(uri)
+
+	owner, err := cmd.Flags().GetString("owner")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if owner == "" {
+		owner = pkg.NewLockOwner()
+	}
+	reentrant, err := cmd.Flags().GetBool("reentrant")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ttl, err := cmd.Flags().GetDuration("ttl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if ttl <= 0 {
+		log.Fatalf("Invalid --ttl value %s: must be positive", ttl)
+	}
+
+	b := c.Bucket(lockURI.Bucket)
+	lock := b.Lock(lockURI.Path, owner, ttl)
+	lock.Reentrant = reentrant
+	return lock
+}
+
+// acquireLock acquires a lock, waiting for as long as the --wait flag allows. If the lock is held by
+// another owner, the program exits with status exitLockHeld.
+func acquireLock(cmd *cobra.Command, lock *pkg.Lock) {
+	wait, err := cmd.Flags().GetDuration("wait")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = lock.AcquireWait(wait)
+	var held *pkg.LockHeldError
+	if errors.As(err, &held) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitLockHeld)
+	} else if err != nil {
+		log.Fatalf("Couldn't acquire lock: %v\n", err)
+	}
+}
+
+// renewLock renews a lock's lease every third of its TTL until stop is closed, returning whether the
+// lease was still held. Failed renewals are retried at the next interval; once the lease is lost or
+// hasn't been renewed for a whole TTL, process is killed.
+func renewLock(lock *pkg.Lock, process *os.Process, stop <-chan struct{}) bool {
+	ticker := time.NewTicker(lock.TTL / 3)
+	defer ticker.Stop()
+
+	lastRenewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return true
+		case <-ticker.C:
+		}
+
+		err := lock.Renew()
+		if err == nil {
+			lastRenewed = time.Now()
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Couldn't renew lock: %v\n", err)
+		if errors.Is(err, pkg.ErrLockLost) || time.Since(lastRenewed) >= lock.TTL {
+			process.Kill()
+			<-stop
+			return false
+		}
+	}
+}
+
+func init() {
+	// Add the lock command and its subcommands to the root command
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.AddCommand(lockAcquireCmd, lockReleaseCmd, lockRunCmd)
+
+	// Add flags shared by the lock subcommands
+	lockCmd.PersistentFlags().Duration("ttl", time.Minute, "How long each lease is held before it must be renewed")
+	lockCmd.PersistentFlags().String("owner", "", "Owner recorded in the lease (default unique to this invocation)")
+	lockCmd.PersistentFlags().Bool("reentrant", false, "Take over unexpired leases recorded under the same --owner")
+	lockAcquireCmd.Flags().Duration("wait", 0, "How long to wait for a held lock before giving up")
+	lockRunCmd.Flags().Duration("wait", 0, "How long to wait for a held lock before giving up")
+}
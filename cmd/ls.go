@@ -11,12 +11,16 @@ import (
 // lsCmd represents the ls command
 var lsCmd = &cobra.Command{
 	Use:   "ls [bucket-name]",
-	Short: "List objects in a bucket",
-	Long: `List objects in an R2 bucket.
+	Short: "List either all buckets or all objects in a bucket",
+	Long: `List the objects in R2 buckets, or the buckets in the account.
 
-To list objects in a bucket, provide the bucket name as an argument.
+To list objects in a bucket, provide the bucket name as an argument. Without
+arguments, the buckets in the account are listed, as with buckets ls.
 
 Examples:
+  # List all buckets, with their object counts and sizes
+  r2 ls --with-stats
+
   # List all objects in a bucket
   r2 ls example-bucket
 
@@ -25,8 +29,13 @@ Examples:
 
   # List objects using R2 URI format
   r2 ls r2://example-bucket`,
-	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		// Without arguments, list buckets
+		if len(args) == 0 {
+			listBuckets(cmd)
+			return
+		}
+
 		// Get profile client
 		profileName, err := cmd.Flags().GetString("profile")
 		if err != nil {
@@ -48,4 +57,7 @@ Examples:
 func init() {
 	// Add the ls command to the root command
 	rootCmd.AddCommand(lsCmd)
+
+	// Add flags for listing buckets when no bucket is given
+	addBucketListFlags(lsCmd)
 }
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"fmt"
 	"log"
 
 	"github.com/erdos-one/r2/pkg"
@@ -11,9 +10,37 @@ import (
 
 // mbCmd represents the mb command
 var mbCmd = &cobra.Command{
-	Use:   "mb",
+	Use:   "mb bucket-name [bucket-name...]",
 	Short: "Create an R2 bucket",
-	Long:  ``,
+	Long: `Create one or more R2 buckets.
+
+Buckets may be given by name or as R2 URIs. Pass --location to hint where the
+buckets' data should be stored, and the global --jurisdiction flag to create
+them in a jurisdiction, which guarantees their data stays within it. Buckets in
+a jurisdiction can only be accessed with the same --jurisdiction (or the
+jurisdiction profile setting).
+
+Location hints:
+  wnam  Western North America
+  enam  Eastern North America
+  weur  Western Europe
+  eeur  Eastern Europe
+  apac  Asia-Pacific
+  oc    Oceania
+
+Examples:
+  # Create a bucket
+  r2 mb example-bucket
+
+  # Create several buckets in Western Europe
+  r2 mb r2://logs r2://backups --location weur
+
+  # Create a bucket whose data stays in the EU
+  r2 mb r2://eu-data --jurisdiction eu
+
+  # Create a bucket unless it already exists, e.g. in provisioning scripts
+  r2 mb r2://example-bucket --if-not-exists`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get profile client
 		profileName, err := cmd.Flags().GetString("profile")
@@ -22,12 +49,24 @@ var mbCmd = &cobra.Command{
 		}
 		c := pkg.Client(getProfile(profileName))
 
-		// If a bucket name is provided, create the bucket
-		if len(args) > 0 {
-			bucketName := args[0]
-			c.MakeBucket(bucketName)
-		} else {
-			fmt.Println("Please provide a bucket name")
+		// Get bucket settings
+		var opts pkg.MakeBucketOptions
+		if opts.Location, err = cmd.Flags().GetString("location"); err != nil {
+			log.Fatal(err)
+		}
+		if opts.IfNotExists, err = cmd.Flags().GetBool("if-not-exists"); err != nil {
+			log.Fatal(err)
+		}
+
+		// Create each bucket passed
+		for _, arg := range args {
+			uri := pkg.ParseR2URISafe(arg)
+			if uri.Path != "" {
+				log.Fatalf("Please provide a bucket rather than an object: r2://%s", uri.Bucket)
+			}
+			if err := c.MakeBucketWithOptions(uri.Bucket, opts); err != nil {
+				log.Fatalf("Error creating bucket %s: %v\n", uri.Bucket, err)
+			}
 		}
 	},
 }
@@ -35,4 +74,8 @@ var mbCmd = &cobra.Command{
 func init() {
 	// Add the mb command to the root command
 	rootCmd.AddCommand(mbCmd)
+
+	// Add bucket creation flags
+	mbCmd.Flags().String("location", "", "Location hint for the buckets' data: wnam, enam, weur, eeur, apac or oc")
+	mbCmd.Flags().Bool("if-not-exists", false, "Succeed if a bucket already exists in the account")
 }
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// multipartCmd represents the multipart command
+var multipartCmd = &cobra.Command{
+	Use:   "multipart",
+	Short: "Manage incomplete multipart uploads",
+	Long: `List and abort incomplete multipart uploads.
+
+Uploads that fail or are interrupted part-way, e.g. a pipe whose input was cut
+off, leave their uploaded parts behind. These parts don't show up in ls, but
+are stored and billed until the upload is aborted.
+
+Examples:
+  # List incomplete uploads in a bucket
+  r2 multipart ls r2://bucket
+
+  # Abort incomplete uploads started more than a day ago
+  r2 multipart abort r2://bucket --older-than 24h
+
+  # Abort a specific upload
+  r2 multipart abort r2://bucket/backups/db.sql.gz --upload-id <upload-id>`,
+}
+
+// multipartLsCmd represents the multipart ls command
+var multipartLsCmd = &cobra.Command{
+	Use:   "ls r2://bucket[/prefix] [r2://bucket[/prefix]...]",
+	Short: "List incomplete multipart uploads",
+	Long: `List incomplete multipart uploads, optionally only those whose keys start with
+a prefix.
+
+For each upload, the initiation date, number and total size of the parts
+uploaded so far, upload ID and key are printed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		// List uploads in each location passed
+		for _, arg := range args {
+			uri := pkg.ParseR2URISafe(arg)
+			b := c.Bucket(uri.Bucket)
+			if err := b.PrintMultipartUploads(uri.Path); err != nil {
+				log.Fatalf("Couldn't list multipart uploads in %s: %v\n", arg, err)
+			}
+		}
+	},
+}
+
+// multipartAbortCmd represents the multipart abort command
+var multipartAbortCmd = &cobra.Command{
+	Use:   "abort r2://bucket[/prefix]",
+	Short: "Abort incomplete multipart uploads, deleting their parts",
+	Long: `Abort incomplete multipart uploads, deleting the parts uploaded so far.
+
+Pass --upload-id with the upload's full R2 URI to abort a single upload. To
+abort every upload whose key starts with a prefix, pass --older-than to skip
+recent uploads that may still be in progress, or --all to abort them too.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		uploadID, err := cmd.Flags().GetString("upload-id")
+		if err != nil {
+			log.Fatal(err)
+		}
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			log.Fatal(err)
+		}
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		uri := pkg.ParseR2URISafe(args[0])
+		b := c.Bucket(uri.Bucket)
+
+		// Abort a single upload
+		if uploadID != "" {
+			if uri.Path == "" {
+				log.Fatal("Please provide the upload's full R2 URI, including its key, with --upload-id.")
+			}
+			if err := b.AbortMultipartUpload(uri.Path, uploadID); err != nil {
+				log.Fatalf("Couldn't abort upload %s of %s: %v\n", uploadID, args[0], err)
+			}
+			fmt.Printf("Aborted %s %s\n", uploadID, args[0])
+			return
+		}
+
+		// Abort every matching upload, refusing to touch recent uploads unless asked to
+		if olderThan <= 0 && !all {
+			log.Fatal("Please pass --older-than, --upload-id or --all to choose the uploads to abort.")
+		}
+		aborted, err := b.AbortMultipartUploads(uri.Path, olderThan)
+		for _, upload := range aborted {
+			fmt.Printf("Aborted %s r2://%s/%s (%d parts, %s)\n", upload.UploadID, uri.Bucket, upload.Key, upload.Parts, pkg.FormatSize(upload.Size))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	// Add the multipart command and its subcommands to the root command
+	rootCmd.AddCommand(multipartCmd)
+	multipartCmd.AddCommand(multipartLsCmd, multipartAbortCmd)
+
+	// Add flags choosing the uploads to abort
+	multipartAbortCmd.Flags().String("upload-id", "", "ID of a single upload to abort")
+	multipartAbortCmd.Flags().Duration("older-than", 0, "Only abort uploads initiated longer ago than this, e.g. 24h")
+	multipartAbortCmd.Flags().Bool("all", false, "Abort all matching uploads, including any still in progress")
+}
@@ -30,7 +30,10 @@ var mvCmd = &cobra.Command{
 				// Move local file to R2
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(destURI.Bucket)
-				b.Upload(sourcePath, destURI.Path)
+				err = b.UploadWithOptions(sourcePath, destURI.Path, getPutOptions(cmd))
+				if err != nil {
+					log.Fatal(err)
+				}
 				os.Remove(sourcePath)
 			} else if pkg.IsR2URI(sourcePath) && !pkg.IsR2URI(destinationPath) {
 				// Move R2 object to local file
@@ -43,7 +46,10 @@ var mvCmd = &cobra.Command{
 				sourceURI := pkg.ParseR2URISafe(sourcePath)
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(sourceURI.Bucket)
-				b.Copy(sourceURI.Path, destURI)
+				err = b.CopyWithOptions(sourceURI.Path, destURI, getCopyOptions(cmd))
+				if err != nil {
+					log.Fatal(err)
+				}
 				b.Delete(sourceURI.Path)
 			}
 		} else {
@@ -55,4 +61,8 @@ var mvCmd = &cobra.Command{
 func init() {
 	// Add the mv command to the root command
 	rootCmd.AddCommand(mvCmd)
+
+	// Add flags for written object metadata and copies
+	addCopyFlags(mvCmd)
+	addPutFlags(mvCmd)
 }
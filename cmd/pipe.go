@@ -31,7 +31,17 @@ Examples:
   tar czf - /path/to/dir | r2 pipe r2://bucket/archive.tar.gz
 
   # Stream from a file
-  cat large-file.bin | r2 pipe r2://bucket/large-file.bin`,
+  cat large-file.bin | r2 pipe r2://bucket/large-file.bin
+
+  # Set the content type and cache headers of the object
+  generate-report | r2 pipe r2://bucket/report.html \
+    --content-type text/html --cache-control "max-age=300"
+
+  # Compress a day of logs with zstd, keeping the object's name
+  journalctl --since yesterday --until today | r2 pipe r2://logs/app.log --compress zstd
+
+  # Encrypt the object server-side with a customer-provided key (SSE-C)
+  pg_dump mydb | r2 pipe r2://backups/db.sql --sse-c-key-file ./sse.key`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get the target path
@@ -46,8 +56,7 @@ Examples:
 		uri := pkg.ParseR2URISafe(target)
 
 		// Check if stdin is a terminal (no piped input)
-		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) != 0 {
+		if isTerminal(os.Stdin) {
 			fmt.Println("Error: No data provided on stdin")
 			fmt.Println("Usage: <command> | r2 pipe r2://bucket/path")
 			os.Exit(1)
@@ -83,8 +92,16 @@ Examples:
 			fmt.Printf("Streaming to r2://%s/%s...\n", uri.Bucket, uri.Path)
 		}
 
-		err = b.PutStream(reader, uri.Path, partSize, concurrency)
-		if err != nil {
+		display := newProgressDisplay()
+		opts := getPutOptions(cmd)
+		opts.IfMatch, opts.IfNoneMatch = getConditions(cmd)
+		opts.SSECustomerKey = getSSECustomerKey(cmd, "sse-c-key")
+		opts.Progress = display.progressFunc(quiet)
+		err = b.PutStreamWithOptions(reader, uri.Path, partSize, concurrency, opts)
+		display.finish()
+		if pkg.IsPreconditionFailed(err) {
+			fatalTransferError(err)
+		} else if err != nil {
 			log.Fatalf("Failed to stream to r2://%s/%s: %v\n", uri.Bucket, uri.Path, err)
 		}
 
@@ -102,4 +119,9 @@ func init() {
 	pipeCmd.Flags().Int64("part-size", 5*1024*1024, "Part size for multipart upload in bytes (minimum 5MB, default 5MB)")
 	pipeCmd.Flags().Int("concurrency", 5, "Number of concurrent upload threads")
 	pipeCmd.Flags().BoolP("quiet", "q", false, "Suppress progress output")
+
+	// Add flags for conditional writes, written object metadata and SSE-C keys
+	addConditionFlags(pipeCmd)
+	addPutFlags(pipeCmd)
+	addSSECustomerKeyFlags(pipeCmd, false)
 }
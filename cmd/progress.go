@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/erdos-one/r2/pkg"
+)
+
+// progressRedrawInterval limits how often the progress line is redrawn on terminals.
+const progressRedrawInterval = 100 * time.Millisecond
+
+// isTerminal checks if a file is attached to a terminal rather than a pipe or regular file.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && (stat.Mode()&os.ModeCharDevice) != 0
+}
+
+// progressDisplay renders transfer progress events on stderr. On terminals, a status line showing
+// bytes transferred, transfer rate, ETA and files done is redrawn in place. Otherwise, a plain line
+// is printed as each object completes. In both cases, finish prints a summary of all transfers.
+type progressDisplay struct {
+	mu       sync.Mutex
+	tty      bool
+	start    time.Time
+	lastDraw time.Time
+
+	// Totals, known up front if a TransferPlanned event was received
+	planned     bool
+	filesTotal  int
+	bytesTotal  int64
+	unknownSize bool
+
+	// Progress so far
+	filesDone    int
+	filesFailed  int
+	filesDeleted int
+	bytesDone    int64
+	sizes        map[string]int64
+	transferred  map[string]int64
+}
+
+// newProgressDisplay returns a progressDisplay writing to stderr.
+func newProgressDisplay() *progressDisplay {
+	return &progressDisplay{
+		tty:         isTerminal(os.Stderr),
+		sizes:       make(map[string]int64),
+		transferred: make(map[string]int64),
+	}
+}
+
+// progressFunc returns the display's event handler, or nil if quiet is set so that no progress is
+// reported at all.
+func (d *progressDisplay) progressFunc(quiet bool) pkg.ProgressFunc {
+	if quiet {
+		return nil
+	}
+	return d.handle
+}
+
+// handle updates the display with a progress event. It is safe for concurrent use.
+func (d *progressDisplay) handle(e pkg.ProgressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Measure rates from the first event, so time spent before transfers begin isn't counted
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+
+	switch e.Type {
+	case pkg.TransferPlanned:
+		d.planned = true
+		d.filesTotal = e.Count
+		d.bytesTotal = e.Size
+	case pkg.TransferStarted:
+		d.sizes[e.URI] = e.Size
+		if !d.planned {
+			d.filesTotal++
+			if e.Size < 0 {
+				d.unknownSize = true
+			} else {
+				d.bytesTotal += e.Size
+			}
+		}
+	case pkg.TransferProgress:
+		d.bytesDone += e.Bytes
+		d.transferred[e.URI] += e.Bytes
+		if d.tty && time.Since(d.lastDraw) < progressRedrawInterval {
+			return
+		}
+	case pkg.TransferCompleted:
+		if e.Err != nil {
+			d.filesFailed++
+		} else {
+			d.filesDone++
+		}
+		if !d.tty {
+			if e.Err != nil {
+				fmt.Fprintf(os.Stderr, "failed: %s: %v\n", e.URI, e.Err)
+			} else {
+				fmt.Fprintf(os.Stderr, "done: %s (%s)\n", e.URI, pkg.FormatSize(d.transferred[e.URI]))
+			}
+		}
+		delete(d.sizes, e.URI)
+		delete(d.transferred, e.URI)
+	case pkg.ObjectDeleted:
+		if e.Err != nil {
+			d.filesFailed++
+		} else {
+			d.filesDeleted++
+		}
+		if !d.tty {
+			if e.Err != nil {
+				fmt.Fprintf(os.Stderr, "failed: %s: %v\n", e.URI, e.Err)
+			} else {
+				fmt.Fprintf(os.Stderr, "deleted: %s\n", e.URI)
+			}
+		}
+	}
+
+	if d.tty {
+		d.draw()
+	}
+}
+
+// rate returns the average transfer rate so far in bytes per second.
+func (d *progressDisplay) rate() float64 {
+	elapsed := time.Since(d.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(d.bytesDone) / elapsed
+}
+
+// draw redraws the status line. The caller must hold the mutex.
+func (d *progressDisplay) draw() {
+	d.lastDraw = time.Now()
+
+	line := fmt.Sprintf("%d/%d files  %s", d.filesDone, d.filesTotal, pkg.FormatSize(d.bytesDone))
+	if !d.unknownSize {
+		line += " / " + pkg.FormatSize(d.bytesTotal)
+	}
+	rate := d.rate()
+	line += fmt.Sprintf("  %s/s", pkg.FormatSize(int64(rate)))
+	if !d.unknownSize && rate > 0 && d.bytesTotal >= d.bytesDone {
+		eta := time.Duration(float64(d.bytesTotal-d.bytesDone) / rate * float64(time.Second))
+		line += "  ETA " + eta.Round(time.Second).String()
+	}
+
+	// Return to the start of the line and clear it before writing
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+}
+
+// watchProgressFunc returns an event handler for long-running watches, which logs each completed
+// transfer and deletion with a timestamp rather than drawing a status line, or nil if quiet is set.
+// Failures are left to the watch's error reporting.
+func watchProgressFunc(quiet bool) pkg.ProgressFunc {
+	if quiet {
+		return nil
+	}
+	return func(e pkg.ProgressEvent) {
+		switch {
+		case e.Err != nil:
+		case e.Type == pkg.TransferCompleted:
+			log.Printf("uploaded: %s", e.URI)
+		case e.Type == pkg.ObjectDeleted:
+			log.Printf("deleted: %s", e.URI)
+		}
+	}
+}
+
+// finish ends the display, printing a summary of all transfers. Nothing is printed if no transfers
+// took place.
+func (d *progressDisplay) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.tty && !d.lastDraw.IsZero() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if d.filesDone == 0 && d.filesFailed == 0 && d.filesDeleted == 0 {
+		return
+	}
+
+	elapsed := time.Since(d.start)
+	summary := fmt.Sprintf("Transferred %d files (%s) in %s, %s/s",
+		d.filesDone, pkg.FormatSize(d.bytesDone), elapsed.Round(time.Millisecond), pkg.FormatSize(int64(d.rate())))
+	if d.filesDeleted > 0 {
+		summary += fmt.Sprintf(", %d deleted", d.filesDeleted)
+	}
+	if d.filesFailed > 0 {
+		summary += fmt.Sprintf(", %d failed", d.filesFailed)
+	}
+	fmt.Fprintln(os.Stderr, summary)
+}
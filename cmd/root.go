@@ -9,6 +9,21 @@ import (
 // Store version information
 var version string = "unset"
 
+// Exit codes used by commands to report specific failures to scripts. General errors exit with 1.
+const (
+	// exitNotFound is used when a requested object does not exist
+	exitNotFound = 2
+
+	// exitPreconditionFailed is used when a conditional transfer's precondition isn't met
+	exitPreconditionFailed = 3
+
+	// exitLockHeld is used when a lock is held by another owner, or was lost while held
+	exitLockHeld = 4
+
+	// exitDiffers is used when compared locations differ
+	exitDiffers = 5
+)
+
 // rootCmd represents the base command when called without any commands
 var rootCmd = &cobra.Command{
 	Use:   "r2",
@@ -44,6 +59,20 @@ func init() {
 	// Enable profile flag for all commands
 	rootCmd.PersistentFlags().StringP("profile", "p", "default", "R2 profile to use")
 
+	// Enable retry policy flags for all commands, overriding the profile's settings
+	rootCmd.PersistentFlags().Int("max-attempts", 0, "Maximum attempts per request, including the first (default 3)")
+	rootCmd.PersistentFlags().String("retry-mode", "", "Retry backoff mode: standard or adaptive (default standard)")
+	rootCmd.PersistentFlags().Duration("request-timeout", 0, "Time to wait for a response to each request before retrying")
+
+	// Enable bandwidth limit flag for all commands, overriding the profile's setting
+	rootCmd.PersistentFlags().String("max-bandwidth", "", "Limit upload and download bandwidth, e.g. 50MB/s (0 for unlimited)")
+
+	// Enable jurisdiction flag for all commands, overriding the profile's setting
+	rootCmd.PersistentFlags().String("jurisdiction", "", "Jurisdiction of the buckets used: eu or fedramp")
+
+	// Enable client-side encryption flag for all commands, overriding the profile's setting
+	rootCmd.PersistentFlags().String("encryption-key-file", "", "File holding a 256-bit key to encrypt uploads and decrypt downloads with, client-side")
+
 	// Add version flag
 	rootCmd.Flags().BoolP("version", "v", false, "Print version information and quit")
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// statCmd represents the stat command
+var statCmd = &cobra.Command{
+	Use:     "stat r2://bucket/key [r2://bucket/key...]",
+	Aliases: []string{"head"},
+	Short:   "Show the metadata of R2 objects",
+	Long: `Show the metadata of one or more R2 objects without downloading them.
+
+For each object, the size, ETag, last modified date, content headers, storage
+class, checksums and user metadata are printed. If any object doesn't exist,
+the remaining objects are still printed and the command exits with status 2.
+The metadata of objects encrypted server-side with a customer-provided key
+(SSE-C) can only be read with the key, given with --sse-c-key or
+--sse-c-key-file.
+
+Examples:
+  # Show the metadata of an object
+  r2 stat r2://bucket/path/to/object.txt
+
+  # Show the metadata of several objects
+  r2 stat r2://bucket/a.txt r2://bucket/b.txt`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		opts := pkg.GetOptions{SSECustomerKey: getSSECustomerKey(cmd, "sse-c-key")}
+
+		// Print the metadata of each object, remembering whether any were missing
+		missing := false
+		for i, arg := range args {
+			if !pkg.IsR2URI(arg) {
+				log.Fatalf("Path %s is not a valid R2 URI", arg)
+			}
+			uri := pkg.ParseR2URISafe(arg)
+			b := c.Bucket(uri.Bucket)
+
+			// Separate objects with a blank line
+			if i > 0 {
+				fmt.Println()
+			}
+
+			err := b.PrintStatWithOptions(uri.Path, opts)
+			if pkg.IsNotFound(err) {
+				fmt.Fprintf(os.Stderr, "r2://%s/%s: object not found\n", uri.Bucket, uri.Path)
+				missing = true
+			} else if err != nil {
+				log.Fatalf("Couldn't stat r2://%s/%s: %v\n", uri.Bucket, uri.Path, err)
+			}
+		}
+
+		if missing {
+			os.Exit(exitNotFound)
+		}
+	},
+}
+
+func init() {
+	// Add the stat command to the root command
+	rootCmd.AddCommand(statCmd)
+
+	// Add flags for SSE-C keys
+	addSSECustomerKeyFlags(statCmd, false)
+}
@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/erdos-one/r2/pkg"
 
@@ -12,7 +15,45 @@ import (
 var syncCmd = &cobra.Command{
 	Use:   "sync",
 	Short: "Syncs directories and R2 prefixes.",
-	Long:  ``,
+	Long: `Syncs directories and R2 prefixes, transferring only new or changed files.
+
+Progress is shown on stderr: a live status line with bytes, rate, ETA and files
+done on terminals, or a line per completed object otherwise, followed by a
+summary. Pass --quiet to suppress it.
+
+When --storage-class is set, objects already in sync but stored in a different
+storage class are transitioned to it in place, without re-uploading them.
+
+--sse-c-key or --sse-c-key-file encrypts uploaded objects server-side with a
+customer-provided key (SSE-C), and decrypts downloaded ones. For syncs between
+R2 locations, the key encrypts the destination, and --sse-c-copy-source-key or
+--sse-c-copy-source-key-file gives the source's key.
+
+--compress gzip|zstd compresses uploaded objects, setting their Content-Encoding
+while keeping their names, and objects uploaded with --compress are
+decompressed when downloaded. Compressed objects are compared by the size and
+hash of their uncompressed contents.
+
+--delete deletes objects that no longer exist in the local directory. It is
+only supported for syncs from a local directory to R2.
+
+--watch keeps a local directory synced to R2 until interrupted: after an initial
+sync, files are uploaded as they change, once they've gone --debounce without
+changing, and with --delete their objects are deleted as they're removed. A full
+sync runs every --reconcile-interval to catch changes that were missed.
+
+Examples:
+  # Sync a local directory to R2
+  r2 sync ./backups r2://bucket/backups
+
+  # Sync an R2 prefix to a local directory
+  r2 sync r2://bucket/backups ./backups
+
+  # Move an archive prefix to Infrequent Access
+  r2 sync ./archive r2://bucket/archive --storage-class InfrequentAccess
+
+  # Mirror an upload directory continuously, deleting removed files
+  r2 sync --watch --delete ./uploads r2://bucket/uploads`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Get profile client
 		profileName, err := cmd.Flags().GetString("profile")
@@ -21,6 +62,29 @@ var syncCmd = &cobra.Command{
 		}
 		c := pkg.Client(getProfile(profileName))
 
+		// Report progress unless quiet
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			log.Fatal(err)
+		}
+		display := newProgressDisplay()
+		opts := pkg.SyncOptions{Put: getPutOptions(cmd), Progress: display.progressFunc(quiet)}
+		opts.Put.SSECustomerKey = getSSECustomerKey(cmd, "sse-c-key")
+		opts.Get.SSECustomerKey = opts.Put.SSECustomerKey
+		if opts.Delete, err = cmd.Flags().GetBool("delete"); err != nil {
+			log.Fatal(err)
+		}
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if watch && (len(args) != 2 || pkg.IsR2URI(args[0]) || !pkg.IsR2URI(args[1])) {
+			log.Fatal("--watch is only supported for syncs from a local directory to R2.")
+		}
+		if opts.Delete && (len(args) != 2 || pkg.IsR2URI(args[0]) || !pkg.IsR2URI(args[1])) {
+			log.Fatal("--delete is only supported for syncs from a local directory to R2.")
+		}
+
 		// If a bucket name is provided, create the bucket
 		if len(args) == 2 {
 			sourcePath := args[0]
@@ -29,19 +93,36 @@ var syncCmd = &cobra.Command{
 				// Sync local directory to R2 bucket
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(destURI.Bucket)
-				b.SyncLocalToR2WithPrefix(sourcePath, destURI.Path)
+				if watch {
+					watchLocalToR2(cmd, &b, sourcePath, destURI.Path, opts, quiet)
+					return
+				}
+				err = b.SyncLocalToR2WithOptions(sourcePath, destURI.Path, opts)
+				display.finish()
+				if err != nil {
+					log.Fatal(err)
+				}
 			} else if pkg.IsR2URI(sourcePath) && !pkg.IsR2URI(destinationPath) {
 				// Sync R2 bucket to local directory
 				sourceURI := pkg.ParseR2URISafe(sourcePath)
 				b := c.Bucket(sourceURI.Bucket)
-				b.SyncR2ToLocalWithPrefix(destinationPath, sourceURI.Path)
+				err = b.SyncR2ToLocalWithOptions(destinationPath, sourceURI.Path, opts)
+				display.finish()
+				if err != nil {
+					log.Fatal(err)
+				}
 			} else if pkg.IsR2URI(sourcePath) && pkg.IsR2URI(destinationPath) {
 				// Sync R2 bucket to R2 bucket
 				sourceURI := pkg.ParseR2URISafe(sourcePath)
 				destURI := pkg.ParseR2URISafe(destinationPath)
 				b := c.Bucket(sourceURI.Bucket)
 				destBucket := c.Bucket(destURI.Bucket)
-				b.SyncR2ToR2WithPrefix(destBucket, sourceURI.Path, destURI.Path)
+				opts.Get.SSECustomerKey = getSSECustomerKey(cmd, "sse-c-copy-source-key")
+				err = b.SyncR2ToR2WithOptions(destBucket, sourceURI.Path, destURI.Path, opts)
+				display.finish()
+				if err != nil {
+					log.Fatal(err)
+				}
 			} else if !pkg.IsR2URI(sourcePath) && !pkg.IsR2URI(destinationPath) {
 				// Both paths are local - not supported
 				log.Fatal("Local-to-local sync is not supported. At least one path must be an R2 URI (r2://bucket/path).")
@@ -52,7 +133,56 @@ var syncCmd = &cobra.Command{
 	},
 }
 
+// watchLocalToR2 keeps a local directory synced to R2 until the process is interrupted, using the
+// debounce and reconciliation intervals given by the --debounce and --reconcile-interval flags.
+func watchLocalToR2(cmd *cobra.Command, b *pkg.R2Bucket, sourcePath, prefix string, opts pkg.SyncOptions, quiet bool) {
+	debounce, err := cmd.Flags().GetDuration("debounce")
+	if err != nil {
+		log.Fatal(err)
+	}
+	reconcileInterval, err := cmd.Flags().GetDuration("reconcile-interval")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if debounce <= 0 || reconcileInterval <= 0 {
+		log.Fatal("--debounce and --reconcile-interval must be positive")
+	}
+
+	// Log each change rather than drawing a status line, as the watch runs indefinitely
+	opts.Progress = watchProgressFunc(quiet)
+	watchOpts := pkg.WatchOptions{Sync: opts, Debounce: debounce, ReconcileInterval: reconcileInterval}
+
+	// Stop watching when interrupted
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	if !quiet {
+		log.Printf("Watching %s for changes to sync to r2://%s/%s", sourcePath, b.Name, prefix)
+	}
+	if err := b.WatchLocalToR2(sourcePath, prefix, watchOpts, stop); err != nil {
+		log.Fatal(err)
+	}
+}
+
 func init() {
 	// Add the sync command to the root command
 	rootCmd.AddCommand(syncCmd)
+
+	// Add progress flag
+	syncCmd.Flags().BoolP("quiet", "q", false, "Suppress progress output")
+
+	// Add flags for deletions and watching
+	syncCmd.Flags().Bool("delete", false, "Delete objects whose local files no longer exist (local to R2 syncs only)")
+	syncCmd.Flags().Bool("watch", false, "Keep syncing a local directory to R2 as files change, until interrupted")
+	syncCmd.Flags().Duration("debounce", pkg.DefaultWatchDebounce, "With --watch, how long a file must go without changing before it's uploaded")
+	syncCmd.Flags().Duration("reconcile-interval", pkg.DefaultWatchReconcileInterval, "With --watch, how often a full sync runs to catch missed changes")
+
+	// Add flags for written object metadata and SSE-C keys
+	addPutFlags(syncCmd)
+	addSSECustomerKeyFlags(syncCmd, true)
 }
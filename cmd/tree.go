@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// treeCmd represents the tree command
+var treeCmd = &cobra.Command{
+	Use:   "tree r2://bucket[/prefix/]",
+	Short: "Show the objects under a prefix as a tree",
+	Long: `Show the virtual directories and objects under a prefix as a tree, built from
+/-delimited keys.
+
+Pass --depth to limit the levels shown, --dirs-only to hide objects, and
+--sizes to show each node's size. Directory sizes roll up every object below
+them, including objects deeper than --depth.
+
+Examples:
+  # Show a bucket as a tree
+  r2 tree r2://bucket
+
+  # Show two levels of directories under logs/ with their sizes
+  r2 tree r2://bucket/logs/ --depth 2 --dirs-only --sizes`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		var opts pkg.TreeOptions
+		if opts.Depth, err = cmd.Flags().GetInt("depth"); err != nil {
+			log.Fatal(err)
+		}
+		if opts.Depth < 0 {
+			log.Fatalf("Invalid --depth value %d: must be 0 (unlimited) or more", opts.Depth)
+		}
+		if opts.DirsOnly, err = cmd.Flags().GetBool("dirs-only"); err != nil {
+			log.Fatal(err)
+		}
+		if opts.Sizes, err = cmd.Flags().GetBool("sizes"); err != nil {
+			log.Fatal(err)
+		}
+
+		uri := pkg.ParseR2URISafe(args[0])
+		b := c.Bucket(uri.Bucket)
+		if err := b.PrintTree(uri.Path, opts); err != nil {
+			log.Fatalf("Couldn't list %s: %v\n", args[0], err)
+		}
+	},
+}
+
+func init() {
+	// Add the tree command to the root command
+	rootCmd.AddCommand(treeCmd)
+
+	// Add tree display flags
+	treeCmd.Flags().IntP("depth", "d", 0, "Number of levels to show below the prefix (0 for unlimited)")
+	treeCmd.Flags().Bool("dirs-only", false, "Only show directories")
+	treeCmd.Flags().BoolP("sizes", "s", false, "Show the size of each object and the size and object count of each directory")
+}
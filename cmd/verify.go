@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/erdos-one/r2/pkg"
+
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify LOCAL r2://bucket[/prefix]",
+	Short: "Verify the integrity of files copied to R2",
+	Long: `Verify that every file in a local directory has an intact copy under an R2
+prefix, by hashing each file again and comparing it against the strongest
+checksum stored with its object (SHA-256, SHA-1, CRC32C or CRC32), or its ETag
+otherwise. Objects uploaded in multiple parts are checked part by part.
+
+Failures are reported as:
+  missing     the file has no object
+  corrupt     the object's size or hash doesn't match the file
+  extra       the object has no file
+  unverified  the object couldn't be checked, e.g. because its metadata
+              couldn't be fetched
+
+Objects encrypted with SSE-C are read with --sse-c-key or --sse-c-key-file,
+which --fix also encrypts uploads with. Pass --fix to upload missing and
+corrupt files again, and --delete with --fix to delete extra objects. -o json prints a result for every file, including
+those verified, e.g. to keep as evidence.
+
+verify exits with status 0 when every file is intact (or was fixed), and 5
+otherwise.
+
+Examples:
+  # Verify an archive
+  r2 verify ./archive r2://bucket/archive
+
+  # Repair an archive, removing objects whose files were deleted
+  r2 verify ./archive r2://bucket/archive --fix --delete
+
+  # Record the verification of every file
+  r2 verify ./archive r2://bucket/archive -o json > verification.json`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts pkg.VerifyOptions
+		var err error
+		if opts.Fix, err = cmd.Flags().GetBool("fix"); err != nil {
+			log.Fatal(err)
+		}
+		if opts.Delete, err = cmd.Flags().GetBool("delete"); err != nil {
+			log.Fatal(err)
+		}
+		if opts.Delete && !opts.Fix {
+			log.Fatal("--delete can only be used with --fix.")
+		}
+		opts.SSECustomerKey = getSSECustomerKey(cmd, "sse-c-key")
+		opts.Put.SSECustomerKey = opts.SSECustomerKey
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if output != "text" && output != "json" {
+			log.Fatalf("Invalid --output value %q: must be text or json", output)
+		}
+		if pkg.IsR2URI(args[0]) || !pkg.IsR2URI(args[1]) {
+			log.Fatal("Please provide a local directory and an R2 URI (r2://bucket/path), in that order.")
+		}
+
+		// Get profile client
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := pkg.Client(getProfile(profileName))
+
+		uri := pkg.ParseR2URISafe(args[1])
+		b := c.Bucket(uri.Bucket)
+		results, err := b.Verify(args[0], uri.Path, opts)
+		if results == nil && err != nil {
+			log.Fatalf("Couldn't verify %s against %s: %v\n", args[0], args[1], err)
+		}
+
+		if output == "json" {
+			if results == nil {
+				results = []pkg.VerifyResult{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if encodeErr := encoder.Encode(results); encodeErr != nil {
+				log.Fatal(encodeErr)
+			}
+		} else {
+			pkg.PrintVerifyResults(results)
+		}
+
+		if err != nil {
+			log.Printf("Couldn't fix all files:\n%v\n", err)
+		}
+		if pkg.VerifyFailed(results) {
+			os.Exit(exitDiffers)
+		}
+	},
+}
+
+func init() {
+	// Add the verify command to the root command
+	rootCmd.AddCommand(verifyCmd)
+
+	// Add repair and output flags
+	verifyCmd.Flags().Bool("fix", false, "Upload missing and corrupt files again")
+	verifyCmd.Flags().Bool("delete", false, "With --fix, delete objects that have no local file")
+	verifyCmd.Flags().StringP("output", "o", "text", "Output format: text or json")
+	addSSECustomerKeyFlags(verifyCmd, false)
+}
@@ -0,0 +1,107 @@
+// Bandwidth limiting
+
+package pkg
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiterChunk is the most bytes a limited reader reads at once, so that large reads are
+// spread out rather than arriving in bursts followed by long pauses.
+const bandwidthLimiterChunk = 32 * 1024
+
+// bandwidthLimiter is a token bucket limiting the rate at which bytes are transferred. A single
+// limiter is shared by all transfers made through a client, so concurrent workers split the
+// available bandwidth between them rather than each getting the full rate.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter returns a limiter allowing bytesPerSecond bytes to be transferred per second,
+// or nil, which doesn't limit transfers, if bytesPerSecond isn't positive.
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &bandwidthLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes may be transferred. Tokens are taken immediately, even if it leaves the
+// bucket in debt, so that waiting transfers are served in the order they arrived.
+func (l *bandwidthLimiter) wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// limitedReader wraps a reader, limiting the rate at which it can be read.
+type limitedReader struct {
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > bandwidthLimiterChunk {
+		b = b[:bandwidthLimiterChunk]
+	}
+	n, err := l.r.Read(b)
+	l.limiter.wait(n)
+	return n, err
+}
+
+// limitedReadSeeker is a limitedReader over a seekable reader, which remains seekable so the SDK
+// can determine its length and rewind it.
+type limitedReadSeeker struct {
+	*limitedReader
+}
+
+func (l limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return l.r.(io.Seeker).Seek(offset, whence)
+}
+
+// withBandwidthLimit wraps a reader so that reading from it is limited by the given limiter.
+// Seekable readers remain seekable. If the limiter is nil, the reader is returned unchanged.
+func withBandwidthLimit(r io.Reader, limiter *bandwidthLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	l := &limitedReader{r: r, limiter: limiter}
+	if _, ok := r.(io.Seeker); ok {
+		return limitedReadSeeker{l}
+	}
+	return l
+}
+
+// limitedReadCloser is a limitedReader which closes the underlying reader, used for the bodies of
+// downloaded objects.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
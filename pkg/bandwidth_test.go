@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimitConcurrentReaders(t *testing.T) {
+	// The limiter starts with a second's worth of tokens, so the rest takes at least half a second
+	const rate = 512 * 1024
+	const readers = 4
+	limiter := newBandwidthLimiter(rate)
+	data := testPlaintext(rate * 3 / 2 / readers)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := io.ReadAll(withBandwidthLimit(bytes.NewReader(data), limiter))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("read %d bytes, %v, want %d bytes unchanged", len(got), err, len(data))
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	if elapsed < 450*time.Millisecond {
+		t.Errorf("%d readers read %d bytes in %s, faster than %d bytes per second together", readers, readers*len(data), elapsed, rate)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("%d readers read %d bytes in %s, much slower than %d bytes per second", readers, readers*len(data), elapsed, rate)
+	}
+}
+
+func TestBandwidthLimitSeek(t *testing.T) {
+	data := testPlaintext(3 * bandwidthLimiterChunk)
+	r, ok := withBandwidthLimit(bytes.NewReader(data), newBandwidthLimiter(1<<30)).(io.ReadSeeker)
+	if !ok {
+		t.Fatal("limiting a seekable reader didn't return a seekable reader")
+	}
+
+	// Seeking to the end gives the length, as the SDK does to find the body's length
+	if end, err := r.Seek(0, io.SeekEnd); err != nil || end != int64(len(data)) {
+		t.Fatalf("Seek(0, io.SeekEnd) = %d, %v, want %d", end, err, len(data))
+	}
+
+	// Read part of the data, then rewind, as when a request is retried
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(r, make([]byte, bandwidthLimiterChunk)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data read after rewinding differs")
+	}
+
+	// Non-seekable readers stay non-seekable
+	if _, ok := withBandwidthLimit(struct{ io.Reader }{bytes.NewReader(data)}, newBandwidthLimiter(1<<30)).(io.Seeker); ok {
+		t.Error("limiting a non-seekable reader returned a seeker")
+	}
+}
+
+func TestBandwidthLimitZero(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		limiter := newBandwidthLimiter(rate)
+		if limiter != nil {
+			t.Fatalf("newBandwidthLimiter(%d) = %v, want nil", rate, limiter)
+		}
+
+		// Readers are passed through untouched, and waiting never blocks
+		r := bytes.NewReader(testPlaintext(10))
+		if got := withBandwidthLimit(r, limiter); got != io.Reader(r) {
+			t.Errorf("withBandwidthLimit with limit %d wrapped the reader", rate)
+		}
+		start := time.Now()
+		limiter.wait(1 << 40)
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("wait with limit %d blocked for %s", rate, elapsed)
+		}
+	}
+}
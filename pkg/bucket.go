@@ -5,12 +5,16 @@ package pkg
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"os"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
@@ -56,6 +60,25 @@ func (b *R2Bucket) GetObjects() []types.Object {
 // This function properly handles pagination to retrieve all objects, even if there are more than 1000.
 func (b *R2Bucket) GetObjectsWithPrefix(prefix string) []types.Object {
 	var allObjects []types.Object
+	err := b.WalkObjectsWithPrefix(prefix, func(object types.Object) error {
+		allObjects = append(allObjects, object)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return allObjects
+}
+
+// ErrStopWalk may be returned by the function passed to WalkObjectsWithPrefix to stop the walk early
+// without failing it.
+var ErrStopWalk = errors.New("stop walk")
+
+// WalkObjectsWithPrefix calls fn for each object in a bucket that has the specified prefix, in key
+// order. Unlike GetObjectsWithPrefix, objects are listed a page at a time and never held in memory
+// all at once, so buckets of any size can be walked. If fn returns an error, the walk stops and the
+// error is returned, unless it is ErrStopWalk, in which case the walk stops without error.
+func (b *R2Bucket) WalkObjectsWithPrefix(prefix string, fn func(types.Object) error) error {
 	var continuationToken *string
 
 	for {
@@ -75,11 +98,17 @@ func (b *R2Bucket) GetObjectsWithPrefix(prefix string) []types.Object {
 
 		listObjectsOutput, err := b.Client.ListObjectsV2(context.TODO(), input)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
-		// Append the objects from this page to our complete list
-		allObjects = append(allObjects, listObjectsOutput.Contents...)
+		// Pass on the objects from this page
+		for _, object := range listObjectsOutput.Contents {
+			if err := fn(object); errors.Is(err, ErrStopWalk) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
 
 		// Check if there are more pages to fetch
 		if listObjectsOutput.IsTruncated != nil && *listObjectsOutput.IsTruncated {
@@ -90,7 +119,7 @@ func (b *R2Bucket) GetObjectsWithPrefix(prefix string) []types.Object {
 		}
 	}
 
-	return allObjects
+	return nil
 }
 
 // GetObjectPaths returns a list of all object paths in a bucket, represented as strings. This
@@ -105,27 +134,29 @@ func (b *R2Bucket) GetObjectPaths() []string {
 
 // PrintObjects prints a list of all objects in a bucket. This method is a wrapper around GetObjects,
 // which returns a list of types.Object structs. The returned list of objects is formatted as a table
-// with the following columns: last modified date, file size, file name. The file size column is
-// formatted as a string with the file size and its unit (e.g. 1.2 MB).
+// with the following columns: last modified date, file size, storage class, file name. The file size
+// column is formatted as a string with the file size and its unit (e.g. 1.2 MB).
 func (b *R2Bucket) PrintObjects() {
-	// Get creation date, file size, and name of each object
+	// Get creation date, file size, storage class, and name of each object
 	var objectData [][]string
 	for _, object := range b.GetObjects() {
 		// Get file size
 		fs := fileSizeFmt(*object.Size)
 
-		// Append last modified, file size, and file name to objectData
+		// Append last modified, file size, storage class, and file name to objectData
 		objectData = append(objectData, []string{
 			object.LastModified.Format("2006-01-02 15:04:05"),
 			fs[0],
 			fs[1],
+			string(objectStorageClass(object)),
 			*object.Key,
 		})
 	}
 
-	// Get length of longest file size string
+	// Get length of longest file size and storage class strings
 	var longestFileSizeString int
 	var longestFileSizeUnitString int
+	var longestStorageClassString int
 	for _, object := range objectData {
 		if len(object[1]) > longestFileSizeString {
 			longestFileSizeString = len(object[1])
@@ -133,6 +164,9 @@ func (b *R2Bucket) PrintObjects() {
 		if len(object[2]) > longestFileSizeUnitString {
 			longestFileSizeUnitString = len(object[2])
 		}
+		if len(object[3]) > longestStorageClassString {
+			longestStorageClassString = len(object[3])
+		}
 	}
 
 	// Print objects
@@ -144,37 +178,173 @@ func (b *R2Bucket) PrintObjects() {
 			object[2],
 			strings.Repeat(" ", longestFileSizeUnitString-len(object[2])),
 			object[3],
+			strings.Repeat(" ", longestStorageClassString-len(object[3])),
+			object[4],
 		)
 	}
 }
 
+// PutOptions holds the optional object metadata applied to uploads. Empty fields are not sent to
+// R2, with the exception of ContentType: when it is empty, the content type is detected from the
+// object's extension and, failing that, by sniffing the first 512 bytes of its contents. Metadata
+// holds user-defined metadata, which R2 stores and returns as x-amz-meta-* headers. StorageClass
+// selects the storage class objects are written to, defaulting to the bucket's default class.
+// IfMatch and IfNoneMatch make the write conditional: IfMatch only writes if the existing object's
+// ETag matches, and IfNoneMatch set to "*" only writes if no object exists. A write whose condition
+// isn't met fails with a PreconditionFailedError. ChecksumAlgorithm, if set, has a checksum of the
+// object computed with the given algorithm and sent with the upload (with each part, for multipart
+// uploads), so R2 rejects data corrupted in transit and stores the checksum with the object.
+// SSECustomerKey, if set, is a 256-bit key R2 encrypts the object with server-side (SSE-C); R2
+// doesn't store the key, so the same key must be given to read the object again. Compress, if set
+// to CompressionGzip or CompressionZstd, compresses the object before it's uploaded and sets its
+// Content-Encoding accordingly, keeping its key and content type; the object is marked as compressed
+// in its metadata, and reads decompress it again unless GetOptions.NoDecompress is set.
+// Progress, if set, receives progress events for the upload.
+type PutOptions struct {
+	ContentType        string
+	CacheControl       string
+	ContentEncoding    string
+	ContentDisposition string
+	Expires            *time.Time
+	Metadata           map[string]string
+	StorageClass       types.StorageClass
+	IfMatch            string
+	IfNoneMatch        string
+	ChecksumAlgorithm  types.ChecksumAlgorithm
+	SSECustomerKey     []byte
+	Compress           string
+	Progress           ProgressFunc
+}
+
+// hasMetadata reports whether any of the options set object metadata, which copies only apply with
+// the REPLACE metadata directive.
+func (o PutOptions) hasMetadata() bool {
+	return o.ContentType != "" || o.CacheControl != "" || o.ContentEncoding != "" ||
+		o.ContentDisposition != "" || o.Expires != nil || len(o.Metadata) > 0
+}
+
+// apply sets the options on a PutObjectInput. The content type must already have been resolved.
+func (o PutOptions) apply(input *s3.PutObjectInput) {
+	if o.ContentType != "" {
+		input.ContentType = aws.String(o.ContentType)
+	}
+	if o.CacheControl != "" {
+		input.CacheControl = aws.String(o.CacheControl)
+	}
+	if o.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(o.ContentEncoding)
+	}
+	if o.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(o.ContentDisposition)
+	}
+	if o.Expires != nil {
+		input.Expires = o.Expires
+	}
+	if len(o.Metadata) > 0 {
+		input.Metadata = o.Metadata
+	}
+	if o.StorageClass != "" {
+		input.StorageClass = o.StorageClass
+	}
+	if o.IfMatch != "" {
+		input.IfMatch = aws.String(o.IfMatch)
+	}
+	if o.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(o.IfNoneMatch)
+	}
+	if o.ChecksumAlgorithm != "" {
+		input.ChecksumAlgorithm = o.ChecksumAlgorithm
+	}
+	sse := sseCustomer(o.SSECustomerKey)
+	input.SSECustomerAlgorithm = sse.algorithm
+	input.SSECustomerKey = sse.key
+	input.SSECustomerKeyMD5 = sse.keyMD5
+}
+
 // Put puts an object into a bucket. The inputted object is represented as an io.Reader, which can
 // be created from a file, a string, or any other type that implements the io.Reader interface. The
 // bucketPath argument takes the path for the object to be put in the bucket.
 func (b *R2Bucket) Put(file io.Reader, bucketPath string) error {
-	_, err := b.Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	return b.PutWithOptions(file, bucketPath, PutOptions{})
+}
+
+// PutWithOptions puts an object into a bucket, applying the given PutOptions to the object. If no
+// content type is provided, it is detected from the bucket path's extension or the object's
+// contents.
+func (b *R2Bucket) PutWithOptions(file io.Reader, bucketPath string, opts PutOptions) error {
+	_, err := b.putObject(file, bucketPath, opts)
+	return err
+}
+
+// putObject puts an object into a bucket like PutWithOptions, returning the full response so callers
+// have access to the written object's ETag.
+func (b *R2Bucket) putObject(file io.Reader, bucketPath string, opts PutOptions) (*s3.PutObjectOutput, error) {
+	if opts.ContentType == "" {
+		contentType, body, err := detectContentType(file, bucketPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect content type: %w", err)
+		}
+		opts.ContentType = contentType
+		file = body
+	}
+
+	// Compress the object into a temporary file, so its compressed size is known before uploading
+	if opts.Compress != "" {
+		compressed, err := b.Client.compressToTempFile(file, &opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress object: %w", err)
+		}
+		defer os.Remove(compressed.Name())
+		defer compressed.Close()
+		file = compressed
+	}
+
+	// Encrypt the object client-side if the client has an encryption key
+	file, err := b.Client.encryptPut(file, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt object: %w", err)
+	}
+
+	uri := fmt.Sprintf("r2://%s/%s", b.Name, bucketPath)
+	opts.Progress.started(uri, readerSize(file))
+
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(b.Name),
 		Key:    aws.String(bucketPath),
-		Body:   file,
-	})
-	return err
+		Body:   withProgress(withBandwidthLimit(file, b.Client.limiter), uri, opts.Progress),
+	}
+	opts.apply(input)
+
+	output, err := b.Client.PutObject(context.TODO(), input)
+	opts.Progress.completed(uri, err)
+	return output, conditionalError(uri, err)
 }
 
 // Upload uploads a local file to a bucket. The localPath argument takes the path to the local file
 // to be uploaded. The bucketPath argument takes the path for the object to be put in the bucket.
 // This method is a wrapper around Put, which takes an io.Reader as an argument.
 func (b *R2Bucket) Upload(localPath, bucketPath string) {
+	err := b.UploadWithOptions(localPath, bucketPath, PutOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// UploadWithOptions uploads a local file to a bucket, applying the given PutOptions to the object.
+// Unlike Upload, errors are returned rather than terminating the program.
+func (b *R2Bucket) UploadWithOptions(localPath, bucketPath string, opts PutOptions) error {
 	file, err := os.Open(localPath)
 	if err != nil {
-		log.Fatalf("Couldn't open file %s to upload: %v\n", localPath, err)
+		return fmt.Errorf("couldn't open file %s to upload: %w", localPath, err)
 	}
 
 	defer file.Close()
 
-	err = b.Put(file, bucketPath)
+	err = b.PutWithOptions(file, bucketPath, opts)
 	if err != nil {
-		log.Fatalf("Couldn't upload file %s to r2://%s/%s: %v\n", localPath, b.Name, bucketPath, err)
+		return fmt.Errorf("couldn't upload file %s to r2://%s/%s: %w", localPath, b.Name, bucketPath, err)
 	}
+	return nil
 }
 
 // PutStream uploads a stream to a bucket using multipart upload for efficient streaming.
@@ -182,16 +352,55 @@ func (b *R2Bucket) Upload(localPath, bucketPath string) {
 // The partSize parameter controls the size of each part in bytes (minimum 5MB).
 // The concurrency parameter controls how many parts are uploaded in parallel.
 func (b *R2Bucket) PutStream(reader io.Reader, bucketPath string, partSize int64, concurrency int) error {
+	return b.PutStreamWithOptions(reader, bucketPath, partSize, concurrency, PutOptions{})
+}
+
+// PutStreamWithOptions uploads a stream to a bucket like PutStream, applying the given PutOptions
+// to the object.
+func (b *R2Bucket) PutStreamWithOptions(reader io.Reader, bucketPath string, partSize int64, concurrency int, opts PutOptions) error {
 	// For stdin and other non-seekable streams, we need to buffer the data first
 	// This allows us to use multipart upload with the seekable bytes.Reader
-	data, err := io.ReadAll(reader)
-	if err != nil {
+	var data []byte
+	var err error
+	if opts.Compress != "" {
+		// Compress the stream as it's read, so only the compressed data is buffered. The whole
+		// stream is read before uploading, as the uncompressed size and hash recorded in the
+		// object's metadata must be known when the upload starts. The content type is detected
+		// from the uncompressed data first.
+		if opts.ContentType == "" {
+			contentType, body, err := detectContentType(reader, bucketPath)
+			if err != nil {
+				return fmt.Errorf("failed to detect content type: %w", err)
+			}
+			opts.ContentType = contentType
+			reader = body
+		}
+		var compressed bytes.Buffer
+		if err := b.Client.compressPut(&compressed, reader, &opts); err != nil {
+			return fmt.Errorf("failed to compress stream: %w", err)
+		}
+		data = compressed.Bytes()
+	} else if data, err = io.ReadAll(reader); err != nil {
 		return fmt.Errorf("failed to read stream: %w", err)
 	}
 
 	// For small files (less than part size), use simple upload
 	if int64(len(data)) <= partSize {
-		return b.Put(bytes.NewReader(data), bucketPath)
+		return b.PutWithOptions(bytes.NewReader(data), bucketPath, opts)
+	}
+
+	// The whole stream is in memory, so the content type can be detected without a reader
+	if opts.ContentType == "" {
+		opts.ContentType = contentTypeOf(bucketPath, data)
+	}
+
+	// Encrypt the object client-side if the client has an encryption key
+	encrypted, err := b.Client.encryptPut(bytes.NewReader(data), &opts)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt object: %w", err)
+	}
+	if data, err = io.ReadAll(encrypted); err != nil {
+		return fmt.Errorf("failed to encrypt object: %w", err)
 	}
 
 	// For larger files, use the S3 manager with multipart upload
@@ -205,233 +414,447 @@ func (b *R2Bucket) PutStream(reader io.Reader, bucketPath string, partSize int64
 		}
 	})
 
+	uri := fmt.Sprintf("r2://%s/%s", b.Name, bucketPath)
+	opts.Progress.started(uri, int64(len(data)))
+
 	// Upload using the manager with the seekable bytes.Reader
 	// This will automatically use multipart upload for large files
-	_, err = uploader.Upload(context.TODO(), &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(b.Name),
 		Key:    aws.String(bucketPath),
-		Body:   bytes.NewReader(data),
-	})
+		Body:   withProgress(withBandwidthLimit(bytes.NewReader(data), b.Client.limiter), uri, opts.Progress),
+	}
+	opts.apply(input)
+	_, err = uploader.Upload(context.TODO(), input)
+	opts.Progress.completed(uri, err)
 
-	return err
+	return conditionalError(uri, err)
+}
+
+// GetOptions holds optional settings for fetching objects. Range restricts the fetched bytes using
+// HTTP range syntax, e.g. "bytes=0-1023" for the first KiB, "bytes=1024-" for everything after it,
+// or "bytes=-1024" for the last KiB. IfMatch and IfNoneMatch make the read conditional on the
+// object's ETag matching or not matching the given value; a read whose condition isn't met fails
+// with a PreconditionFailedError. SSECustomerKey must be set to the key objects encrypted with SSE-C
+// were written with; reads with a missing or wrong key fail with an error wrapping
+// ErrSSECustomerKeyRequired or ErrSSECustomerKey. NoDecompress reads objects compressed when they
+// were uploaded as stored, rather than decompressing them. Progress, if set, receives progress
+// events for downloads made with DownloadWithOptions.
+//
+// Objects stored with a checksum of their whole contents are validated against it as they are read,
+// unless a Range is set; reading a body that doesn't match fails once the end is reached. Composite
+// checksums of objects uploaded in parts can't be validated this way; use Verify to check them.
+type GetOptions struct {
+	Range          string
+	IfMatch        string
+	IfNoneMatch    string
+	SSECustomerKey []byte
+	NoDecompress   bool
+	Progress       ProgressFunc
 }
 
 // Get gets an object from a bucket. The bucketPath argument takes the path to the object in the
 // bucket. This method returns an io.ReadCloser, which can be used to read the object's contents.
 // This method is a wrapper around the S3 GetObject API call.
 func (b *R2Bucket) Get(bucketPath string) io.ReadCloser {
-	obj, err := b.Client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(b.Name),
-		Key:    aws.String(bucketPath),
-	})
+	body, err := b.GetWithOptions(bucketPath, GetOptions{})
 	if err != nil {
 		log.Fatalf("Couldn't get file r2://%s/%s: %v\n", b.Name, bucketPath, err)
 	}
 
-	return obj.Body
+	return body
 }
 
-// Download downloads an object from a bucket to a local file. The bucketPath argument takes the
-// path to the object in the bucket. The localPath argument takes the path to the local file to
-// download to. This method is a wrapper around Get, which returns an io.ReadCloser.
-func (b *R2Bucket) Download(bucketPath, localPath string) {
-	objBody := b.Get(bucketPath)
-
-	file, err := os.Create(localPath)
+// GetWithOptions gets an object from a bucket like Get, applying the given GetOptions. Unlike Get,
+// errors are returned rather than terminating the program. The caller must close the returned
+// io.ReadCloser.
+func (b *R2Bucket) GetWithOptions(bucketPath string, opts GetOptions) (io.ReadCloser, error) {
+	obj, err := b.getObject(bucketPath, opts)
 	if err != nil {
-		log.Fatalf("Couldn't create file %s to download to: %v\n", localPath, err)
+		return nil, err
 	}
 
-	defer file.Close()
-	_, err = io.Copy(file, objBody)
-	if err != nil {
-		log.Fatalf("Couldn't download file r2://%s/%s to %s: %v\n", b.Name, bucketPath, localPath, err)
-	}
+	return obj.Body, nil
 }
 
-// Copy copies an object from a bucket to another bucket. The bucketPath argument takes the path to
-// the object in the bucket. The copyToURI argument takes the URI of the bucket to copy the object
-// to. This method is a wrapper around the S3 CopyObject API call.
-func (b *R2Bucket) Copy(bucketPath string, copyToURI R2URI) {
-	_, err := b.Client.CopyObject(context.TODO(), &s3.CopyObjectInput{
-		Bucket:     aws.String(copyToURI.Bucket),
-		CopySource: aws.String(b.Name + "/" + bucketPath),
-		Key:        aws.String(copyToURI.Path),
-	})
+// getObject calls the S3 GetObject API with the given GetOptions applied, returning the full
+// response so callers have access to the object's metadata as well as its body.
+func (b *R2Bucket) getObject(bucketPath string, opts GetOptions) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.Name),
+		Key:    aws.String(bucketPath),
+	}
+	if opts.Range != "" {
+		input.Range = aws.String(opts.Range)
+	}
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(opts.IfMatch)
+	}
+	if opts.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(opts.IfNoneMatch)
+	}
+	sse := sseCustomer(opts.SSECustomerKey)
+	input.SSECustomerAlgorithm = sse.algorithm
+	input.SSECustomerKey = sse.key
+	input.SSECustomerKeyMD5 = sse.keyMD5
+
+	// Have checksums stored with the object returned, so the body is validated against them as it is
+	// read. Checksums cover whole objects, so ranges can't be validated.
+	if opts.Range == "" {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+
+	uri := fmt.Sprintf("r2://%s/%s", b.Name, bucketPath)
+	obj, err := b.Client.GetObject(context.TODO(), input)
 	if err != nil {
-		log.Fatalf("Couldn't copy file r2://%s/%s to r2://%s/%s: %v\n", b.Name, bucketPath, copyToURI.Bucket, copyToURI.Path, err)
+		return nil, sseCustomerError(uri, opts.SSECustomerKey, conditionalError(uri, err))
+	}
+
+	// Limit the rate at which the body is read
+	if b.Client.limiter != nil {
+		obj.Body = limitedReadCloser{withBandwidthLimit(obj.Body, b.Client.limiter), obj.Body}
+	}
+
+	// Decrypt objects encrypted client-side, then decompress compressed objects
+	if err := b.Client.decryptGet(obj, uri, opts.Range != ""); err != nil {
+		obj.Body.Close()
+		return nil, err
+	}
+	if opts.NoDecompress {
+		return obj, nil
+	}
+	if err := decompressGet(obj, uri, opts.Range != ""); err != nil {
+		obj.Body.Close()
+		return nil, err
 	}
+	return obj, nil
 }
 
-// Delete deletes an object from a bucket. The bucketPath argument takes the path to the object in
-// the bucket. This method is a wrapper around the S3 DeleteObject API call.
-func (b *R2Bucket) Delete(bucketPath string) {
-	_, err := b.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(b.Name),
-		Key:    aws.String(bucketPath),
-	})
+// Stat returns the metadata of an object without fetching its contents. The bucketPath argument
+// takes the path to the object in the bucket. This method is a wrapper around the S3 HeadObject API
+// call, with checksum mode enabled so that any stored checksums are returned. If the object does
+// not exist, the returned error satisfies IsNotFound.
+func (b *R2Bucket) Stat(bucketPath string) (*s3.HeadObjectOutput, error) {
+	return b.StatWithOptions(bucketPath, GetOptions{})
+}
+
+// StatWithOptions returns the metadata of an object like Stat, applying the IfMatch, IfNoneMatch and
+// SSECustomerKey of the given GetOptions. The metadata of objects encrypted with SSE-C can only be
+// read with their key.
+func (b *R2Bucket) StatWithOptions(bucketPath string, opts GetOptions) (*s3.HeadObjectOutput, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(b.Name),
+		Key:          aws.String(bucketPath),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if opts.IfMatch != "" {
+		input.IfMatch = aws.String(opts.IfMatch)
+	}
+	if opts.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(opts.IfNoneMatch)
+	}
+	sse := sseCustomer(opts.SSECustomerKey)
+	input.SSECustomerAlgorithm = sse.algorithm
+	input.SSECustomerKey = sse.key
+	input.SSECustomerKeyMD5 = sse.keyMD5
+
+	uri := fmt.Sprintf("r2://%s/%s", b.Name, bucketPath)
+	head, err := b.Client.HeadObject(context.TODO(), input)
 	if err != nil {
-		log.Fatalf("Couldn't delete file r2://%s/%s: %v\n", b.Name, bucketPath, err)
+		return nil, sseCustomerError(uri, opts.SSECustomerKey, conditionalError(uri, err))
 	}
+	return head, nil
 }
 
-// SyncLocalToR2 syncs a local directory to an R2 bucket. The sourcePath argument takes the path to
-// the local directory to sync. This method iterates through the local directory and uploads any new
-// or changed files to the bucket.
-func (b *R2Bucket) SyncLocalToR2(sourcePath string) {
-	b.SyncLocalToR2WithPrefix(sourcePath, "")
+// PrintStat prints the metadata of an object: its size, ETag, last modified date, content headers,
+// storage class, checksums, SSE-C encryption and user metadata. Headers the object doesn't have are
+// omitted. Errors from Stat are returned, so callers can distinguish missing objects with
+// IsNotFound.
+func (b *R2Bucket) PrintStat(bucketPath string) error {
+	return b.PrintStatWithOptions(bucketPath, GetOptions{})
 }
 
-// SyncLocalToR2WithPrefix syncs a local directory to an R2 bucket with a specific prefix.
-// The sourcePath argument takes the path to the local directory to sync.
-// The prefix argument specifies the prefix to add to all uploaded objects.
-func (b *R2Bucket) SyncLocalToR2WithPrefix(sourcePath string, prefix string) {
-	// Check if source path exists and is a directory
-	if !isDir(sourcePath) {
-		log.Fatal("Source path must be a directory.")
+// PrintStatWithOptions prints the metadata of an object like PrintStat, fetching it with
+// StatWithOptions.
+func (b *R2Bucket) PrintStatWithOptions(bucketPath string, opts GetOptions) error {
+	head, err := b.StatWithOptions(bucketPath, opts)
+	if err != nil {
+		return err
 	}
 
-	// Ensure prefix ends with / if it's not empty
-	if prefix != "" && !strings.HasSuffix(prefix, "/") {
-		prefix = prefix + "/"
+	// Objects in the default storage class are returned without one
+	storageClass := string(head.StorageClass)
+	if storageClass == "" {
+		storageClass = string(types.StorageClassStandard)
 	}
 
-	// Get extant paths and their MD5 checksums in bucket with the specified prefix
-	bucketObjects := make(map[string]string)
-	for _, object := range b.GetObjectsWithPrefix(prefix) {
-		bucketObjects[*object.Key] = strings.Trim(*object.ETag, `"`)
+	fs := fileSizeFmt(aws.ToInt64(head.ContentLength))
+	fields := [][]string{
+		{"Size", fmt.Sprintf("%s %s (%d bytes)", fs[0], fs[1], aws.ToInt64(head.ContentLength))},
+		{"ETag", aws.ToString(head.ETag)},
+		{"Last Modified", aws.ToTime(head.LastModified).Format("2006-01-02 15:04:05")},
+		{"Content-Type", aws.ToString(head.ContentType)},
+		{"Cache-Control", aws.ToString(head.CacheControl)},
+		{"Content-Encoding", aws.ToString(head.ContentEncoding)},
+		{"Content-Disposition", aws.ToString(head.ContentDisposition)},
+		{"Expires", aws.ToString(head.ExpiresString)},
+		{"Storage Class", storageClass},
+		{"Checksum CRC32", aws.ToString(head.ChecksumCRC32)},
+		{"Checksum CRC32C", aws.ToString(head.ChecksumCRC32C)},
+		{"Checksum SHA1", aws.ToString(head.ChecksumSHA1)},
+		{"Checksum SHA256", aws.ToString(head.ChecksumSHA256)},
+		{"Checksum Type", string(head.ChecksumType)},
+		{"SSE-C Algorithm", aws.ToString(head.SSECustomerAlgorithm)},
+		{"SSE-C Key MD5", aws.ToString(head.SSECustomerKeyMD5)},
 	}
 
-	// Iterate through paths in source directory
-	err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// Sort user metadata keys for stable output
+	metadataKeys := make([]string, 0, len(head.Metadata))
+	for key := range head.Metadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+
+	fmt.Printf("r2://%s/%s\n", b.Name, bucketPath)
+	for _, field := range fields {
+		if field[1] != "" {
+			fmt.Printf("  %-21s%s\n", field[0]+":", field[1])
 		}
+	}
+	if len(metadataKeys) > 0 {
+		fmt.Println("  Metadata:")
+		for _, key := range metadataKeys {
+			fmt.Printf("    %s: %s\n", key, head.Metadata[key])
+		}
+	}
 
-		// If path is a file, upload it
-		if !info.IsDir() {
-			// Get relative path from source directory
-			relativePath := strings.TrimPrefix(path, sourcePath)
-			relativePath = strings.TrimPrefix(relativePath, "/")
+	return nil
+}
 
-			// Add prefix to create final bucket path
-			bucketPath := prefix + relativePath
+// Download downloads an object from a bucket to a local file. The bucketPath argument takes the
+// path to the object in the bucket. The localPath argument takes the path to the local file to
+// download to. This method is a wrapper around Get, which returns an io.ReadCloser.
+func (b *R2Bucket) Download(bucketPath, localPath string) {
+	err := b.DownloadWithOptions(bucketPath, localPath, GetOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-			objectMD5, objectInBucket := bucketObjects[bucketPath]
-			if !objectInBucket || (md5sum(path) != objectMD5) {
-				b.Upload(path, bucketPath)
-			}
-		}
+// DownloadWithOptions downloads an object from a bucket to a local file like Download, applying the
+// given GetOptions. Unlike Download, errors are returned rather than terminating the program.
+func (b *R2Bucket) DownloadWithOptions(bucketPath, localPath string, opts GetOptions) error {
+	uri := fmt.Sprintf("r2://%s/%s", b.Name, bucketPath)
 
-		return nil
-	})
+	obj, err := b.getObject(bucketPath, opts)
+	if err != nil {
+		return fmt.Errorf("couldn't get file %s: %w", uri, err)
+	}
+	defer obj.Body.Close()
+
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("couldn't create file %s to download to: %w", localPath, err)
+	}
+	defer file.Close()
 
+	// Decompressed objects may be of unknown size
+	size := int64(-1)
+	if obj.ContentLength != nil {
+		size = *obj.ContentLength
+	}
+	opts.Progress.started(uri, size)
+	_, err = io.Copy(file, withProgress(obj.Body, uri, opts.Progress))
+	opts.Progress.completed(uri, err)
 	if err != nil {
-		log.Fatal(err)
+		// Don't leave incomplete or corrupt files behind
+		file.Close()
+		os.Remove(localPath)
+		return fmt.Errorf("couldn't download file %s to %s: %w", uri, localPath, err)
 	}
+	return nil
 }
 
-// SyncR2ToLocal syncs an R2 bucket to a local directory. The destinationPath argument takes the
-// path to the local directory to sync. This method iterates through the bucket and downloads any
-// new or changed files to the local directory.
-func (b *R2Bucket) SyncR2ToLocal(destinationPath string) {
-	b.SyncR2ToLocalWithPrefix(destinationPath, "")
+// ErrCopyMetadata is returned when copying objects between R2 locations with metadata in
+// CopyOptions.Put but without the REPLACE metadata directive, which would ignore the metadata.
+var ErrCopyMetadata = errors.New("object metadata can only be set on copies between R2 locations with the REPLACE metadata directive")
+
+// CopyOptions holds optional settings for copying objects. By default, the copy keeps the source
+// object's metadata; setting MetadataDirective to types.MetadataDirectiveReplace replaces it with
+// the metadata in Put instead. Setting metadata in Put without it is an error (ErrCopyMetadata)
+// rather than being silently ignored. Put.StorageClass is applied in either case. Objects larger than
+// MultipartThreshold (DefaultMultipartCopyThreshold if zero) are copied in parts of PartSize bytes
+// (DefaultCopyPartSize if zero), Concurrency (DefaultCopyConcurrency if zero) at a time.
+// Put.Progress, if set, receives progress events for the copy as the destination is written.
+//
+// SourceSSECustomerKey must be set to the key the source was written with if it is encrypted with
+// SSE-C, and Put.SSECustomerKey to the key to encrypt the destination with, if any. The keys may
+// differ, so copies can re-encrypt objects with a new key, or add or remove SSE-C, without the data
+// leaving R2.
+type CopyOptions struct {
+	Put                  PutOptions
+	MetadataDirective    types.MetadataDirective
+	MultipartThreshold   int64
+	PartSize             int64
+	Concurrency          int
+	SourceSSECustomerKey []byte
 }
 
-// SyncR2ToLocalWithPrefix syncs objects from an R2 bucket with a specific prefix to a local directory.
-// The destinationPath argument takes the path to the local directory to sync.
-// The prefix argument specifies which objects to sync (only objects with this prefix).
-func (b *R2Bucket) SyncR2ToLocalWithPrefix(destinationPath string, prefix string) {
-	// Check if destination path exists and is a directory
-	if !isDir(destinationPath) {
-		log.Fatal("Destination path must be a directory.")
+// Copy copies an object from a bucket to another bucket. The bucketPath argument takes the path to
+// the object in the bucket. The copyToURI argument takes the URI of the bucket to copy the object
+// to. This method is a wrapper around the S3 CopyObject API call.
+func (b *R2Bucket) Copy(bucketPath string, copyToURI R2URI) {
+	err := b.CopyWithOptions(bucketPath, copyToURI, CopyOptions{})
+	if err != nil {
+		log.Fatal(err)
 	}
+}
 
-	// Iterate through objects with the specified prefix and download necessary ones
-	for _, object := range b.GetObjectsWithPrefix(prefix) {
-		objectPath := *object.Key
-		hash := strings.Trim(*object.ETag, `"`)
+// CopyWithOptions copies an object from a bucket to another bucket like Copy, applying the given
+// CopyOptions. Objects too large for a single CopyObject call are copied with a parallel multipart
+// copy, preserving or replacing their metadata in the same way. Unlike Copy, errors are returned
+// rather than terminating the program.
+func (b *R2Bucket) CopyWithOptions(bucketPath string, copyToURI R2URI, opts CopyOptions) error {
+	wrapErr := func(err error) error {
+		return fmt.Errorf("couldn't copy file r2://%s/%s to r2://%s/%s: %w", b.Name, bucketPath, copyToURI.Bucket, copyToURI.Path, err)
+	}
 
-		// Remove prefix from object path to get relative path
-		relativePath := objectPath
-		if prefix != "" {
-			relativePath = strings.TrimPrefix(objectPath, prefix)
-			// Also remove leading slash if present
-			relativePath = strings.TrimPrefix(relativePath, "/")
-		}
+	// R2 has no conditional copies, so refuse rather than silently copying unconditionally
+	if opts.Put.IfMatch != "" || opts.Put.IfNoneMatch != "" {
+		return wrapErr(fmt.Errorf("conditional writes aren't supported for copies between R2 locations"))
+	}
 
-		// Construct local file path
-		localPath := filepath.Join(destinationPath, relativePath)
+	// Copies happen server-side, so the data can't be compressed on the way
+	if opts.Put.Compress != "" {
+		return wrapErr(fmt.Errorf("compression isn't supported for copies between R2 locations"))
+	}
 
-		// Security check: ensure the path is within the destination directory
-		absLocalPath, err := filepath.Abs(localPath)
-		if err != nil {
-			log.Printf("Warning: could not resolve path %s: %v", localPath, err)
-			continue
-		}
-		absDestPath, err := filepath.Abs(destinationPath)
-		if err != nil {
-			log.Printf("Warning: could not resolve destination path %s: %v", destinationPath, err)
-			continue
+	// Metadata in Put only replaces the source's with the REPLACE directive, so refuse rather than
+	// silently dropping it
+	if opts.MetadataDirective != types.MetadataDirectiveReplace && opts.Put.hasMetadata() {
+		return wrapErr(ErrCopyMetadata)
+	}
+
+	// The source's size decides how it is copied, and its metadata may need to be carried over
+	head, err := b.StatWithOptions(bucketPath, GetOptions{SSECustomerKey: opts.SourceSSECustomerKey})
+	if err != nil {
+		return wrapErr(err)
+	}
+
+	// Resolve the metadata of the copy
+	metadata := putOptionsFromHead(head)
+	if opts.MetadataDirective == types.MetadataDirectiveReplace {
+		metadata = opts.Put
+		if metadata.ContentType == "" {
+			metadata.ContentType = mime.TypeByExtension(path.Ext(copyToURI.Path))
 		}
-		if !strings.HasPrefix(absLocalPath, absDestPath+string(filepath.Separator)) && absLocalPath != absDestPath {
-			log.Printf("Warning: skipping file %s - path traversal detected", objectPath)
-			continue
+		if metadata.ContentType == "" {
+			metadata.ContentType = aws.ToString(head.ContentType)
 		}
+		metadata.Metadata = keepTransformMetadata(head.Metadata, metadata.Metadata)
 
-		// Check if file needs to be downloaded
-		if !fileExists(localPath) || (fileExists(localPath) && (md5sum(localPath) != hash)) {
-			ensureDirExists(localPath)
-			b.Download(objectPath, localPath)
+		// Compressed objects must keep their Content-Encoding to be decompressed when read
+		if objectCompression(head.Metadata) != "" {
+			metadata.ContentEncoding = aws.ToString(head.ContentEncoding)
 		}
 	}
-}
+	if opts.Put.StorageClass != "" {
+		metadata.StorageClass = opts.Put.StorageClass
+	}
+	metadata.ChecksumAlgorithm = opts.Put.ChecksumAlgorithm
+	metadata.SSECustomerKey = opts.Put.SSECustomerKey
 
-// SyncR2ToR2 syncs an R2 bucket to another R2 bucket. The destBucket argument takes the bucket to
-// sync to. This method iterates through the bucket and copies any new or changed files to the
-// destination bucket.
-func (b *R2Bucket) SyncR2ToR2(destBucket R2Bucket) {
-	b.SyncR2ToR2WithPrefix(destBucket, "", "")
-}
+	uri := fmt.Sprintf("r2://%s/%s", copyToURI.Bucket, copyToURI.Path)
+	size := aws.ToInt64(head.ContentLength)
+	progress := opts.Put.Progress
+	progress.started(uri, size)
 
-// SyncR2ToR2WithPrefix syncs objects from an R2 bucket with a specific prefix to another R2 bucket.
-// The sourcePrefix specifies which objects to sync from the source bucket.
-// The destPrefix specifies the prefix to add to objects in the destination bucket.
-func (b *R2Bucket) SyncR2ToR2WithPrefix(destBucket R2Bucket, sourcePrefix string, destPrefix string) {
-	// Ensure prefixes end with / if they're not empty
-	if sourcePrefix != "" && !strings.HasSuffix(sourcePrefix, "/") {
-		sourcePrefix = sourcePrefix + "/"
+	threshold := opts.MultipartThreshold
+	if threshold <= 0 {
+		threshold = DefaultMultipartCopyThreshold
 	}
-	if destPrefix != "" && !strings.HasSuffix(destPrefix, "/") {
-		destPrefix = destPrefix + "/"
+	if size > threshold {
+		err := b.multipartCopy(bucketPath, size, copyToURI, metadata, opts)
+		progress.completed(uri, err)
+		if err != nil {
+			return wrapErr(err)
+		}
+		return nil
 	}
 
-	// Get extant paths and their MD5 checksums in source bucket with prefix
-	sourceBucketObjects := make(map[string]string)
-	for _, object := range b.GetObjectsWithPrefix(sourcePrefix) {
-		sourceBucketObjects[*object.Key] = strings.Trim(*object.ETag, `"`)
+	sse, sourceSSE := sseCustomer(opts.Put.SSECustomerKey), sseCustomer(opts.SourceSSECustomerKey)
+	input := &s3.CopyObjectInput{
+		Bucket:                         aws.String(copyToURI.Bucket),
+		CopySource:                     aws.String(b.Name + "/" + bucketPath),
+		Key:                            aws.String(copyToURI.Path),
+		StorageClass:                   opts.Put.StorageClass,
+		ChecksumAlgorithm:              opts.Put.ChecksumAlgorithm,
+		SSECustomerAlgorithm:           sse.algorithm,
+		SSECustomerKey:                 sse.key,
+		SSECustomerKeyMD5:              sse.keyMD5,
+		CopySourceSSECustomerAlgorithm: sourceSSE.algorithm,
+		CopySourceSSECustomerKey:       sourceSSE.key,
+		CopySourceSSECustomerKeyMD5:    sourceSSE.keyMD5,
+	}
+	if opts.MetadataDirective == types.MetadataDirectiveReplace {
+		var put s3.PutObjectInput
+		metadata.apply(&put)
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.ContentType = put.ContentType
+		input.CacheControl = put.CacheControl
+		input.ContentEncoding = put.ContentEncoding
+		input.ContentDisposition = put.ContentDisposition
+		input.Expires = put.Expires
+		input.Metadata = put.Metadata
 	}
 
-	// Get extant paths and their MD5 checksums in destination bucket with prefix
-	destBucketObjects := make(map[string]string)
-	for _, object := range destBucket.GetObjectsWithPrefix(destPrefix) {
-		destBucketObjects[*object.Key] = strings.Trim(*object.ETag, `"`)
+	_, err = b.Client.CopyObject(context.TODO(), input)
+	if err == nil {
+		progress.transferred(uri, size)
 	}
+	progress.completed(uri, err)
+	if err != nil {
+		return wrapErr(err)
+	}
+	return nil
+}
 
-	// Iterate through paths in source bucket and copy necessary ones
-	for sourcePath, sourceHash := range sourceBucketObjects {
-		// Calculate destination path
-		relativePath := sourcePath
-		if sourcePrefix != "" {
-			relativePath = strings.TrimPrefix(sourcePath, sourcePrefix)
-		}
-		destPath := destPrefix + relativePath
+// SetStorageClass transitions an object to another storage class. The object is copied onto itself
+// with the new storage class, so its contents and metadata are unchanged and no data leaves R2.
+// Objects too large for a single CopyObject call are copied in parts, as by CopyWithOptions. Objects
+// encrypted with SSE-C need their key, which is used to read the object and encrypt it again; it is
+// nil for other objects.
+func (b *R2Bucket) SetStorageClass(bucketPath string, storageClass types.StorageClass, sseCustomerKey []byte) error {
+	err := b.CopyWithOptions(bucketPath, R2URI{Bucket: b.Name, Path: bucketPath}, CopyOptions{
+		Put:                  PutOptions{StorageClass: storageClass, SSECustomerKey: sseCustomerKey},
+		SourceSSECustomerKey: sseCustomerKey,
+		MetadataDirective:    types.MetadataDirectiveCopy,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't change storage class of r2://%s/%s to %s: %w", b.Name, bucketPath, storageClass, err)
+	}
+	return nil
+}
 
-		destHash, sourceObjectInDestBucket := destBucketObjects[destPath]
-		if !sourceObjectInDestBucket || (sourceHash != destHash) {
-			b.Copy(sourcePath, R2URI{Bucket: destBucket.Name, Path: destPath})
-		}
+// Delete deletes an object from a bucket. The bucketPath argument takes the path to the object in
+// the bucket. This method is a wrapper around the S3 DeleteObject API call.
+func (b *R2Bucket) Delete(bucketPath string) {
+	if err := b.DeleteObject(bucketPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// DeleteObject deletes an object from a bucket like Delete, returning errors rather than terminating
+// the program.
+func (b *R2Bucket) DeleteObject(bucketPath string) error {
+	_, err := b.Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: aws.String(b.Name),
+		Key:    aws.String(bucketPath),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't delete file r2://%s/%s: %w", b.Name, bucketPath, err)
 	}
+	return nil
 }
 
 // GetURL returns a presigned URL for an object to get from a bucket. The uri argument takes the
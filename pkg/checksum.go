@@ -0,0 +1,182 @@
+// Checksum computation
+
+package pkg
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// checksumHashes maps the checksum algorithms R2 can store with objects to their hash functions.
+var checksumHashes = map[types.ChecksumAlgorithm]func() hash.Hash{
+	types.ChecksumAlgorithmCrc32:  func() hash.Hash { return crc32.NewIEEE() },
+	types.ChecksumAlgorithmCrc32c: func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	types.ChecksumAlgorithmSha1:   sha1.New,
+	types.ChecksumAlgorithmSha256: sha256.New,
+}
+
+// ParseChecksumAlgorithm parses the name of a checksum algorithm R2 supports: CRC32, CRC32C, SHA1 or
+// SHA256, irrespective of case and dashes (e.g. "sha-256").
+func ParseChecksumAlgorithm(name string) (types.ChecksumAlgorithm, error) {
+	algorithm := types.ChecksumAlgorithm(strings.ToUpper(strings.ReplaceAll(name, "-", "")))
+	if _, ok := checksumHashes[algorithm]; !ok {
+		return "", fmt.Errorf("unknown checksum algorithm %q: must be CRC32, CRC32C, SHA1 or SHA256", name)
+	}
+	return algorithm, nil
+}
+
+// objectChecksum returns the strongest checksum stored with an object and its algorithm, or empty
+// strings if the object has none. The HeadObject call must have had checksum mode enabled.
+func objectChecksum(head *s3.HeadObjectOutput) (types.ChecksumAlgorithm, string) {
+	checksums := []struct {
+		algorithm types.ChecksumAlgorithm
+		value     *string
+	}{
+		{types.ChecksumAlgorithmSha256, head.ChecksumSHA256},
+		{types.ChecksumAlgorithmSha1, head.ChecksumSHA1},
+		{types.ChecksumAlgorithmCrc32c, head.ChecksumCRC32C},
+		{types.ChecksumAlgorithmCrc32, head.ChecksumCRC32},
+	}
+	for _, c := range checksums {
+		if aws.ToString(c.value) != "" {
+			return c.algorithm, aws.ToString(c.value)
+		}
+	}
+	return "", ""
+}
+
+// partCount returns the number of parts in the "-N" suffix of a multipart ETag or composite
+// checksum, or 0 if it has none, in which case it covers the whole object.
+func partCount(value string) int {
+	i := strings.LastIndex(value, "-")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// readerDigests hashes the data of a reader in parts of partSize bytes, or as a whole if partSize is
+// 0, returning the digest of each part.
+func readerDigests(r io.Reader, partSize int64, newHash func() hash.Hash) ([][]byte, error) {
+	var digests [][]byte
+	for {
+		h := newHash()
+		var n int64
+		var err error
+		if partSize > 0 {
+			n, err = io.CopyN(h, r, partSize)
+		} else {
+			n, err = io.Copy(h, r)
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		// Empty files still have a digest, but trailing empty parts don't
+		if n > 0 || len(digests) == 0 {
+			digests = append(digests, h.Sum(nil))
+		}
+		if partSize <= 0 || n < partSize {
+			return digests, nil
+		}
+	}
+}
+
+// combineDigests returns the digest of a multipart object computed from the digests of its parts:
+// the hash of their concatenation, followed by "-" and the number of parts. encode formats the
+// digest, e.g. as hex for ETags or base64 for checksums. A single digest without parts is returned
+// as is.
+func combineDigests(digests [][]byte, multipart bool, newHash func() hash.Hash, encode func([]byte) string) string {
+	if !multipart {
+		return encode(digests[0])
+	}
+	h := newHash()
+	for _, digest := range digests {
+		h.Write(digest)
+	}
+	return fmt.Sprintf("%s-%d", encode(h.Sum(nil)), len(digests))
+}
+
+// localETag computes the ETag R2 would give a local file uploaded in parts of partSize bytes, or in
+// a single request if partSize is 0.
+func localETag(path string, partSize int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readerETag(file, partSize)
+}
+
+// readerETag computes the ETag R2 would give the data of a reader uploaded like localETag.
+func readerETag(r io.Reader, partSize int64) (string, error) {
+	digests, err := readerDigests(r, partSize, md5.New)
+	if err != nil {
+		return "", err
+	}
+	return combineDigests(digests, partSize > 0, md5.New, hex.EncodeToString), nil
+}
+
+// localChecksum computes the checksum R2 would store for a local file uploaded with the given
+// algorithm in parts of partSize bytes, or in a single request if partSize is 0.
+func localChecksum(path string, algorithm types.ChecksumAlgorithm, partSize int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readerChecksum(file, algorithm, partSize)
+}
+
+// readerChecksum computes the checksum R2 would store for the data of a reader uploaded like
+// localChecksum.
+func readerChecksum(r io.Reader, algorithm types.ChecksumAlgorithm, partSize int64) (string, error) {
+	newHash, ok := checksumHashes[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+	}
+	digests, err := readerDigests(r, partSize, newHash)
+	if err != nil {
+		return "", err
+	}
+	return combineDigests(digests, partSize > 0, newHash, base64.StdEncoding.EncodeToString), nil
+}
+
+// objectPartSize returns the size of the first part of an object uploaded in parts, which is the
+// size of every part but the last. Objects encrypted with SSE-C need their key.
+func (b *R2Bucket) objectPartSize(bucketPath string, sseKey []byte) (int64, error) {
+	sse := sseCustomer(sseKey)
+	head, err := b.Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket:               aws.String(b.Name),
+		Key:                  aws.String(bucketPath),
+		PartNumber:           aws.Int32(1),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
+	})
+	if err != nil {
+		return 0, sseCustomerError(fmt.Sprintf("r2://%s/%s", b.Name, bucketPath), sseKey, err)
+	}
+	if aws.ToInt32(head.PartsCount) == 0 {
+		return 0, fmt.Errorf("r2://%s/%s has no parts", b.Name, bucketPath)
+	}
+	return aws.ToInt64(head.ContentLength), nil
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCombineDigests(t *testing.T) {
+	hello, world := md5.Sum([]byte("hello")), md5.Sum([]byte("world"))
+	combined := md5.Sum(append(hello[:], world[:]...))
+	helloOnly := md5.Sum(hello[:])
+
+	tests := []struct {
+		name      string
+		digests   [][]byte
+		multipart bool
+		encode    func([]byte) string
+		want      string
+	}{
+		{
+			name:    "single part",
+			digests: [][]byte{hello[:]},
+			encode:  hex.EncodeToString,
+			want:    "5d41402abc4b2a76b9719d911017c592",
+		},
+		{
+			name:      "one part of a multipart upload",
+			digests:   [][]byte{hello[:]},
+			multipart: true,
+			encode:    hex.EncodeToString,
+			want:      hex.EncodeToString(helloOnly[:]) + "-1",
+		},
+		{
+			name:      "two parts",
+			digests:   [][]byte{hello[:], world[:]},
+			multipart: true,
+			encode:    hex.EncodeToString,
+			want:      hex.EncodeToString(combined[:]) + "-2",
+		},
+		{
+			name:      "base64 checksum",
+			digests:   [][]byte{hello[:], world[:]},
+			multipart: true,
+			encode:    base64.StdEncoding.EncodeToString,
+			want:      base64.StdEncoding.EncodeToString(combined[:]) + "-2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := combineDigests(tt.digests, tt.multipart, md5.New, tt.encode); got != tt.want {
+				t.Errorf("combineDigests = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartCount(t *testing.T) {
+	tests := map[string]int{
+		"5d41402abc4b2a76b9719d911017c592":    0,
+		"9b2cf535f27731c974343645a3985328-2":  2,
+		"9b2cf535f27731c974343645a3985328-10": 10,
+		"n5Kz1A==-3":                          3,
+		"not-a-number":                        0,
+		"":                                    0,
+	}
+	for value, want := range tests {
+		if got := partCount(value); got != want {
+			t.Errorf("partCount(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestLocalETag(t *testing.T) {
+	// 10 bytes uploaded in parts of 4 bytes: "0123", "4567" and "89"
+	path := filepath.Join(t.TempDir(), "file")
+	contents := []byte("0123456789")
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var parts []byte
+	for _, part := range [][]byte{contents[:4], contents[4:8], contents[8:]} {
+		digest := md5.Sum(part)
+		parts = append(parts, digest[:]...)
+	}
+	combined := md5.Sum(parts)
+	whole := md5.Sum(contents)
+
+	// Parts dividing the file exactly don't add an empty trailing part
+	var evenParts []byte
+	for _, part := range [][]byte{contents[:5], contents[5:]} {
+		digest := md5.Sum(part)
+		evenParts = append(evenParts, digest[:]...)
+	}
+	evenCombined := md5.Sum(evenParts)
+
+	tests := []struct {
+		partSize int64
+		want     string
+	}{
+		{0, hex.EncodeToString(whole[:])},
+		{4, hex.EncodeToString(combined[:]) + "-3"},
+		{5, hex.EncodeToString(evenCombined[:]) + "-2"},
+	}
+	for _, tt := range tests {
+		got, err := localETag(path, tt.partSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("localETag(partSize %d) = %q, want %q", tt.partSize, got, tt.want)
+		}
+	}
+
+	// Empty files have the MD5 hash of no data
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emptyHash := md5.Sum(nil)
+	if got, err := localETag(empty, 0); err != nil || got != hex.EncodeToString(emptyHash[:]) {
+		t.Errorf("localETag(empty) = %q, %v, want %q", got, err, hex.EncodeToString(emptyHash[:]))
+	}
+}
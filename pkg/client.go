@@ -4,32 +4,82 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsHTTP "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
 // Config holds the configuration for the R2 client. This is used to authenticate and connect to the
 // R2 API. The profile is the name of the profile in the ~/.r2 configuration file. The account ID is
 // the ID of the R2 account. The access key ID and secret access key are the credentials for the
 // account.
+//
+// The remaining fields are optional settings. RetryMaxAttempts is the maximum number of attempts
+// made for each request, including the first, and RetryMode the backoff mode used between attempts
+// ("standard" or "adaptive"). RequestTimeout is how long to wait for a response to each attempt
+// before it is abandoned and retried. Zero values use the AWS SDK's defaults. MaxBandwidth limits
+// the bytes per second uploaded and downloaded through the client, across all concurrent transfers;
+// zero means unlimited. Jurisdiction is the jurisdiction ("eu" or "fedramp") of the buckets
+// accessed through the client; buckets created in a jurisdiction are only reachable through that
+// jurisdiction's endpoint.
+//
+// EncryptionKey (a 256-bit key encoded in base64 or hex) or EncryptionKeyFile (a file holding one)
+// turns on client-side encryption: objects uploaded through the client are encrypted before they
+// leave the machine, and encrypted objects are decrypted as they are downloaded. EncryptionKey
+// takes precedence if both are set.
 type Config struct {
 	Profile         string
 	AccountID       string
 	AccessKeyID     string
 	SecretAccessKey string
+
+	RetryMaxAttempts int
+	RetryMode        string
+	RequestTimeout   time.Duration
+	MaxBandwidth     int64
+	Jurisdiction     string
+
+	EncryptionKey     string
+	EncryptionKeyFile string
 }
 
+// jurisdictions are the jurisdictions R2 buckets may be created in. A jurisdiction guarantees that a
+// bucket's data is stored within it.
+var jurisdictions = []string{"eu", "fedramp"}
+
+// bucketLocations are the location hints R2 buckets may be created with. A location hint is where R2
+// places a bucket's data, on a best-effort basis.
+var bucketLocations = []string{"wnam", "enam", "weur", "eeur", "apac", "oc"}
+
 // R2Client is a wrapper around the S3 client that provides methods for interacting with R2. This
 // allows us to add methods to the client. The S3 client is embedded in the R2Client struct so that
 // we can use the existing methods of the S3 client without having to re-implement them.
 type R2Client struct {
 	s3.Client
+
+	// limiter is shared by all transfers made through the client
+	limiter *bandwidthLimiter
+
+	// accountID and jurisdiction locate the endpoint of the buckets accessed through the client
+	accountID    string
+	jurisdiction string
+
+	// encryptionKey is the key objects are encrypted with client-side, if any
+	encryptionKey []byte
 }
 
 // s3Client returns a new S3 client for the given profile. The client is configured with the R2
@@ -37,25 +87,100 @@ type R2Client struct {
 // R2PresignClient structs, which are used for all R2 operations.
 func s3Client(c Config) *s3.Client {
 	// R2 requires a dummy region - using "auto" as it's Cloudflare's convention
-	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(),
+	options := []func(*awsConfig.LoadOptions) error{
 		awsConfig.WithRegion("auto"),
 		awsConfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, "")),
-	)
+	}
+
+	// Apply retry policy. Each request, including each part of a multipart transfer, is retried
+	// independently, so a transient failure doesn't restart a whole transfer.
+	if c.RetryMaxAttempts > 0 {
+		options = append(options, awsConfig.WithRetryMaxAttempts(c.RetryMaxAttempts))
+	}
+	if c.RetryMode != "" {
+		mode, err := aws.ParseRetryMode(c.RetryMode)
+		if err != nil {
+			log.Fatalf("Invalid retry mode %q: must be standard or adaptive", c.RetryMode)
+		}
+		options = append(options, awsConfig.WithRetryMode(mode))
+	}
+
+	// Only the wait for a response is limited, so long-running transfers of large bodies aren't cut
+	// short
+	if c.RequestTimeout > 0 {
+		httpClient := awsHTTP.NewBuildableClient().WithTransportOptions(func(t *http.Transport) {
+			t.ResponseHeaderTimeout = c.RequestTimeout
+		})
+		options = append(options, awsConfig.WithHTTPClient(httpClient))
+	}
+
+	cfg, err := awsConfig.LoadDefaultConfig(context.TODO(), options...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if c.Jurisdiction != "" && !Contains(jurisdictions, c.Jurisdiction) {
+		log.Fatalf("Invalid jurisdiction %q: must be one of %s", c.Jurisdiction, strings.Join(jurisdictions, ", "))
+	}
+
 	// Create S3 client with custom R2 endpoint
 	return s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(fmt.Sprintf("https://%s.r2.cloudflarestorage.com", c.AccountID))
+		o.BaseEndpoint = aws.String(r2Endpoint(c.AccountID, c.Jurisdiction))
 		o.UsePathStyle = true
+
+		// Downloads of objects without checksums are common, so don't warn about skipping validation
+		o.DisableLogOutputChecksumValidationSkipped = true
 	})
 }
 
+// r2Endpoint returns the S3 API endpoint of an R2 account. Buckets in a jurisdiction are served
+// from the jurisdiction's own endpoint.
+func r2Endpoint(accountID, jurisdiction string) string {
+	if jurisdiction != "" {
+		return fmt.Sprintf("https://%s.%s.r2.cloudflarestorage.com", accountID, jurisdiction)
+	}
+	return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+}
+
 // Client returns a new R2 client struct so we can add methods to it. The client is configured with
 // the R2 endpoint and credentials for the given profile.
 func Client(c Config) R2Client {
-	return R2Client{*s3Client(c)}
+	return R2Client{
+		Client:        *s3Client(c),
+		limiter:       newBandwidthLimiter(c.MaxBandwidth),
+		accountID:     c.AccountID,
+		jurisdiction:  c.Jurisdiction,
+		encryptionKey: encryptionKey(c),
+	}
+}
+
+// inJurisdiction returns a client like c for the buckets in another jurisdiction, or c itself if
+// it's already the client's. The empty string is the default jurisdiction.
+func (c *R2Client) inJurisdiction(jurisdiction string) *R2Client {
+	if jurisdiction == c.jurisdiction {
+		return c
+	}
+	client := *c
+	client.Client = *s3.New(c.Options(), func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(r2Endpoint(c.accountID, jurisdiction))
+	})
+	client.jurisdiction = jurisdiction
+	return &client
+}
+
+// encryptionKey returns the client-side encryption key configured in c, or nil if there is none.
+func encryptionKey(c Config) []byte {
+	var key []byte
+	var err error
+	if c.EncryptionKey != "" {
+		key, err = ParseEncryptionKey(c.EncryptionKey)
+	} else if c.EncryptionKeyFile != "" {
+		key, err = LoadEncryptionKey(c.EncryptionKeyFile)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return key
 }
 
 // R2PresignClient is a wrapper around the S3 presign client that provides methods for interacting
@@ -77,28 +202,280 @@ func PresignClient(c Config) R2PresignClient {
 // PrintBuckets prints the creation date and name of each bucket in the R2 account.
 func (c *R2Client) PrintBuckets() {
 	// Get buckets
-	listBucketsOutput, err := c.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+	buckets, err := c.GetBuckets(ListBucketsOptions{})
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Print creation date and name of each bucket
-	for _, object := range listBucketsOutput.Buckets {
-		fmt.Println(object.CreationDate.Format("2006-01-02 15:04:05"), *object.Name)
+	for _, bucket := range buckets {
+		fmt.Println(bucket.Created.Format("2006-01-02 15:04:05"), bucket.Name)
 	}
 }
 
+// defaultBucketConcurrency is the number of buckets inspected in parallel by GetBuckets.
+const defaultBucketConcurrency = 8
+
+// ListBucketsOptions holds optional settings for listing buckets. Filter is a glob (as in path.Match)
+// that bucket names must match, e.g. "logs-*". WithLocation looks up each bucket's location hint,
+// and WithStats counts each bucket's objects and their total size by listing all of them, which can
+// take a while for large buckets. Buckets are inspected Concurrency at a time, defaulting to 8.
+type ListBucketsOptions struct {
+	Filter       string
+	WithLocation bool
+	WithStats    bool
+	Concurrency  int
+}
+
+// BucketInfo describes a bucket in the R2 account. Jurisdiction is "default" for buckets outside of
+// any jurisdiction. Location is only set if requested with ListBucketsOptions.WithLocation, and
+// Stats if requested with ListBucketsOptions.WithStats.
+type BucketInfo struct {
+	Name         string       `json:"name"`
+	Created      time.Time    `json:"created"`
+	Jurisdiction string       `json:"jurisdiction"`
+	Location     string       `json:"location,omitempty"`
+	Stats        *BucketStats `json:"stats,omitempty"`
+}
+
+// BucketStats holds the number of objects in a bucket and their total size in bytes.
+type BucketStats struct {
+	Objects int64 `json:"objects"`
+	Size    int64 `json:"size"`
+}
+
+// GetBuckets returns the buckets in the R2 account, sorted by name. Buckets in a jurisdiction are
+// only listed by the jurisdiction's endpoint, so the buckets outside of any jurisdiction and those in
+// each jurisdiction are listed separately and merged, each with its jurisdiction. API tokens may be
+// restricted to a single jurisdiction, so jurisdictions other than the client's that the
+// credentials aren't allowed to list are skipped. This method leverages S3's ListBuckets API call,
+// handling pagination, and looks up any requested details of each bucket in parallel.
+func (c *R2Client) GetBuckets(opts ListBucketsOptions) ([]BucketInfo, error) {
+	if _, err := path.Match(opts.Filter, ""); err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", opts.Filter, err)
+	}
+
+	// List the buckets in each jurisdiction, keeping those matching the filter
+	var buckets []BucketInfo
+	var listErrs []error
+	clients := make(map[string]*R2Client)
+	for _, jurisdiction := range append([]string{""}, jurisdictions...) {
+		client := c.inJurisdiction(jurisdiction)
+		found, err := client.listBuckets(opts.Filter)
+		if isAccessDenied(err) && jurisdiction != c.jurisdiction {
+			continue
+		} else if err != nil {
+			listErrs = append(listErrs, fmt.Errorf("jurisdiction %s: %w", bucketJurisdiction(jurisdiction), err))
+			continue
+		}
+		clients[bucketJurisdiction(jurisdiction)] = client
+		buckets = append(buckets, found...)
+	}
+	if len(listErrs) > 0 {
+		return nil, errors.Join(listErrs...)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+
+	if !opts.WithLocation && !opts.WithStats {
+		return buckets, nil
+	}
+
+	// Look up details of buckets in parallel, limiting the number of buckets inspected at once
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBucketConcurrency
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	semaphore := make(chan struct{}, concurrency)
+	for i := range buckets {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(bucket *BucketInfo) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Buckets are inspected through their jurisdiction's endpoint
+			err := clients[bucket.Jurisdiction].inspectBucket(bucket, opts)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", bucket.Name, err))
+				mu.Unlock()
+			}
+		}(&buckets[i])
+	}
+	wg.Wait()
+
+	return buckets, errors.Join(errs...)
+}
+
+// listBuckets returns the buckets listed by the client's endpoint whose names match filter, in the
+// client's jurisdiction.
+func (c *R2Client) listBuckets(filter string) ([]BucketInfo, error) {
+	var buckets []BucketInfo
+	var continuationToken *string
+	for {
+		output, err := c.ListBuckets(context.TODO(), &s3.ListBucketsInput{ContinuationToken: continuationToken})
+		if err != nil {
+			return nil, err
+		}
+		for _, bucket := range output.Buckets {
+			name := aws.ToString(bucket.Name)
+			if match, _ := path.Match(filter, name); filter != "" && !match {
+				continue
+			}
+			buckets = append(buckets, BucketInfo{
+				Name:         name,
+				Created:      aws.ToTime(bucket.CreationDate),
+				Jurisdiction: bucketJurisdiction(c.jurisdiction),
+			})
+		}
+
+		// Check if there are more pages to fetch
+		if aws.ToString(output.ContinuationToken) == "" {
+			return buckets, nil
+		}
+		continuationToken = output.ContinuationToken
+	}
+}
+
+// bucketJurisdiction returns the name BucketInfo gives a jurisdiction, which is "default" for
+// buckets outside of any jurisdiction.
+func bucketJurisdiction(jurisdiction string) string {
+	if jurisdiction == "" {
+		return "default"
+	}
+	return jurisdiction
+}
+
+// inspectBucket fills in the details of a bucket requested by opts.
+func (c *R2Client) inspectBucket(bucket *BucketInfo, opts ListBucketsOptions) error {
+	if opts.WithLocation {
+		output, err := c.GetBucketLocation(context.TODO(), &s3.GetBucketLocationInput{
+			Bucket: aws.String(bucket.Name),
+		})
+		if err != nil {
+			return err
+		}
+		bucket.Location = strings.ToLower(string(output.LocationConstraint))
+	}
+
+	if opts.WithStats {
+		var stats BucketStats
+		b := c.Bucket(bucket.Name)
+		err := b.WalkObjectsWithPrefix("", func(object types.Object) error {
+			stats.Objects++
+			stats.Size += aws.ToInt64(object.Size)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		bucket.Stats = &stats
+	}
+
+	return nil
+}
+
+// PrintBucketsWithOptions prints the buckets in the R2 account matching opts, formatted as a table
+// with the following columns: creation date, jurisdiction, then location, object count and total
+// size if requested, and name. Buckets whose details couldn't be looked up are still printed, and
+// the errors are returned.
+func (c *R2Client) PrintBucketsWithOptions(opts ListBucketsOptions) error {
+	buckets, err := c.GetBuckets(opts)
+
+	// Format each bucket's columns
+	var rows [][]string
+	for _, bucket := range buckets {
+		row := []string{bucket.Created.Format("2006-01-02 15:04:05"), bucket.Jurisdiction}
+		if opts.WithLocation {
+			location := bucket.Location
+			if location == "" {
+				location = "-"
+			}
+			row = append(row, location)
+		}
+		if opts.WithStats {
+			if bucket.Stats != nil {
+				row = append(row, fmt.Sprintf("%d objects", bucket.Stats.Objects), FormatSize(bucket.Stats.Size))
+			} else {
+				row = append(row, "-", "-")
+			}
+		}
+		rows = append(rows, append(row, bucket.Name))
+	}
+
+	// Pad each column to its widest value, right-aligning counts and sizes
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, value := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+	for _, row := range rows {
+		for i, value := range row[:len(row)-1] {
+			padding := strings.Repeat(" ", widths[i]-len(value))
+			if opts.WithStats && i >= len(row)-3 {
+				fmt.Print(padding, value, "  ")
+			} else {
+				fmt.Print(value, padding, "  ")
+			}
+		}
+		fmt.Println(row[len(row)-1])
+	}
+
+	return err
+}
+
+// MakeBucketOptions holds optional settings for creating a bucket. Location is the location hint
+// for the bucket's data (wnam, enam, weur, eeur, apac or oc); if empty, R2 places the bucket near
+// the request. If IfNotExists is set, creating a bucket the account already owns succeeds instead of
+// failing. A bucket's jurisdiction is set through the client's Config.Jurisdiction.
+type MakeBucketOptions struct {
+	Location    string
+	IfNotExists bool
+}
+
 // MakeBucket creates a new R2 bucket with the given name. The bucket is created in the account
 // associated with the R2 client. The bucket name must be unique across all existing bucket names in
 // the account.
 func (c *R2Client) MakeBucket(name string) {
+	if err := c.MakeBucketWithOptions(name, MakeBucketOptions{}); err != nil {
+		log.Fatalf("Error creating bucket %s: %v\n", name, err)
+	}
+}
+
+// MakeBucketWithOptions creates a new R2 bucket with the given name, like MakeBucket, with the
+// settings in opts. Errors are returned rather than terminating the program.
+func (c *R2Client) MakeBucketWithOptions(name string, opts MakeBucketOptions) error {
+	config := &types.CreateBucketConfiguration{}
+	if opts.Location != "" {
+		location := strings.ToLower(opts.Location)
+		if !Contains(bucketLocations, location) {
+			return fmt.Errorf("invalid location %q: must be one of %s", opts.Location, strings.Join(bucketLocations, ", "))
+		}
+		config.LocationConstraint = types.BucketLocationConstraint(location)
+	}
+
 	_, err := c.CreateBucket(context.TODO(), &s3.CreateBucketInput{
 		Bucket:                    aws.String(name),
-		CreateBucketConfiguration: &types.CreateBucketConfiguration{},
+		CreateBucketConfiguration: config,
 	})
-	if err != nil {
-		log.Fatalf("Error creating bucket %s: %v\n", name, err)
+
+	// The bucket already existing is only an error if it was meant to be new
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "BucketAlreadyOwnedByYou" && opts.IfNotExists {
+		return nil
 	}
+	return err
 }
 
 // RemoveBucket removes the bucket with the given name from the R2 account. The bucket must be empty
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// hostTransport sends every request to a test server, keeping the host it was addressed to.
+type hostTransport struct {
+	server *url.URL
+}
+
+func (t hostTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Host = r.URL.Host
+	r.URL.Scheme, r.URL.Host = t.server.Scheme, t.server.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestGetBucketsJurisdictions(t *testing.T) {
+	// Each jurisdiction's endpoint lists its own buckets; the account can't list FedRAMP buckets
+	listed := map[string][]string{
+		"account.r2.cloudflarestorage.com":    {"logs", "assets"},
+		"account.eu.r2.cloudflarestorage.com": {"eu-data"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names, ok := listed[r.Host]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>")
+			return
+		}
+		var buckets strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&buckets, "<Bucket><Name>%s</Name><CreationDate>2024-01-01T00:00:00.000Z</CreationDate></Bucket>", name)
+		}
+		fmt.Fprintf(w, "<ListAllMyBucketsResult><Buckets>%s</Buckets></ListAllMyBucketsResult>", buckets.String())
+	}))
+	t.Cleanup(server.Close)
+	serverURL, _ := url.Parse(server.URL)
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(r2Endpoint("account", "")),
+		Region:       "auto",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		UsePathStyle: true,
+		HTTPClient:   &http.Client{Transport: hostTransport{serverURL}},
+	})
+	c := &R2Client{Client: *client, accountID: "account"}
+
+	buckets, err := c.GetBuckets(ListBucketsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, bucket := range buckets {
+		got = append(got, bucket.Name+" "+bucket.Jurisdiction)
+	}
+	want := []string{"assets default", "eu-data eu", "logs default"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("GetBuckets = %v, want %v", got, want)
+	}
+
+	// The client's own jurisdiction must be listable
+	if _, err := c.inJurisdiction("fedramp").GetBuckets(ListBucketsOptions{}); err == nil {
+		t.Error("GetBuckets succeeded without access to the client's jurisdiction, want an error")
+	}
+}
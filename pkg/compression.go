@@ -0,0 +1,206 @@
+// Compression of uploads
+
+package pkg
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions objects can be uploaded with, named after the Content-Encoding they are stored with.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionMetadataKey is the user metadata key marking objects compressed when they were
+// uploaded, holding their compression. Only objects with the mark are decompressed when read.
+const compressionMetadataKey = "r2-compression"
+
+// ParseCompression parses the name of a compression objects can be uploaded with: gzip or zstd,
+// irrespective of case.
+func ParseCompression(name string) (string, error) {
+	compression := strings.ToLower(name)
+	if compression != CompressionGzip && compression != CompressionZstd {
+		return "", fmt.Errorf("unknown compression %q: must be gzip or zstd", name)
+	}
+	return compression, nil
+}
+
+// compressionOf returns the compression named by a Content-Encoding or compressionMetadataKey value,
+// or "" if it isn't one this package can decompress.
+func compressionOf(contentEncoding string) string {
+	compression, err := ParseCompression(strings.TrimSpace(contentEncoding))
+	if err != nil {
+		return ""
+	}
+	return compression
+}
+
+// objectCompression returns the compression of an object compressed when it was uploaded, as marked
+// in its metadata, or "" if it wasn't. Objects stored with a Content-Encoding by other means, e.g.
+// pre-compressed .gz files, aren't marked, so they're read as stored.
+func objectCompression(metadata map[string]string) string {
+	return compressionOf(metadata[compressionMetadataKey])
+}
+
+// newCompressWriter returns a writer compressing what is written to it into w.
+func newCompressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compression %q: must be gzip or zstd", compression)
+}
+
+// newDecompressReader returns a reader of the decompressed contents of r. Closing it releases the
+// decompressor, but doesn't close r.
+func newDecompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q: must be gzip or zstd", compression)
+}
+
+// compressPut compresses an upload into w, as requested by opts.Compress. The object's
+// Content-Encoding in opts is set to the compression, and Compress is cleared so the compressed
+// data isn't compressed again. The object is marked as compressed in the metadata of opts, along
+// with the size and hash of the uncompressed data (see uploadHash), recorded under the same keys as
+// for encrypted objects, so compressed objects can be compared with local files without downloading
+// them. The caller's metadata map isn't modified.
+func (c *R2Client) compressPut(w io.Writer, r io.Reader, opts *PutOptions) error {
+	if opts.ContentEncoding != "" && !strings.EqualFold(opts.ContentEncoding, opts.Compress) {
+		return fmt.Errorf("the Content-Encoding of compressed objects can't be set to %s", opts.ContentEncoding)
+	}
+	compressor, err := newCompressWriter(w, opts.Compress)
+	if err != nil {
+		return err
+	}
+
+	// Hash the data as it's compressed
+	newHash, hashKey := c.uploadHash()
+	hash := newHash()
+	size, err := io.Copy(io.MultiWriter(compressor, hash), r)
+	if err != nil {
+		return err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	metadata := map[string]string{
+		compressionMetadataKey: opts.Compress,
+		plaintextSizeKey:       strconv.FormatInt(size, 10),
+		hashKey:                hex.EncodeToString(hash.Sum(nil)),
+	}
+	for key, value := range opts.Metadata {
+		metadata[key] = value
+	}
+	opts.Metadata = metadata
+	opts.ContentEncoding = opts.Compress
+	opts.Compress = ""
+	return nil
+}
+
+// compressToTempFile compresses an upload like compressPut into a temporary file, so the compressed
+// size is known before the upload starts and the data can be re-read if a request is retried. The
+// returned file is positioned at its start; the caller must close and remove it.
+func (c *R2Client) compressToTempFile(r io.Reader, opts *PutOptions) (*os.File, error) {
+	file, err := os.CreateTemp("", "r2-compress-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.compressPut(file, r, opts); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// decompressGet replaces the body of a fetched object with its decompressed contents, if it is
+// stored with the Content-Encoding of a supported compression, adjusting its content length to the
+// recorded uncompressed size, or clearing it if it isn't known. Compressed objects can only be read
+// whole.
+func decompressGet(obj *s3.GetObjectOutput, uri string, ranged bool) error {
+	compression := objectCompression(obj.Metadata)
+	if compression == "" {
+		return nil
+	}
+	if ranged {
+		return fmt.Errorf("%s is compressed with %s, so byte ranges of it can't be read", uri, compression)
+	}
+
+	body, err := newDecompressReader(obj.Body, compression)
+	if err != nil {
+		return fmt.Errorf("couldn't decompress %s: %w", uri, err)
+	}
+	obj.Body = decompressedBody{body, obj.Body}
+	obj.ContentLength = nil
+	if size, err := strconv.ParseInt(obj.Metadata[plaintextSizeKey], 10, 64); err == nil {
+		obj.ContentLength = &size
+	}
+	return nil
+}
+
+// decompressedBody is the decompressed body of an object. Closing it closes both the decompressor
+// and the object's body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
+
+// isTransformed reports whether the stored bytes of an object differ from the data uploaded,
+// because it was compressed or encrypted client-side.
+func isTransformed(head *s3.HeadObjectOutput) bool {
+	return isEncrypted(head.Metadata) || objectCompression(head.Metadata) != ""
+}
+
+// uploadedData returns the size and hash of the data uploaded to an object, before it was
+// compressed or encrypted client-side, as recorded in its metadata. keyed reports whether the hash
+// is an HMAC under a key derived from the uploading client's encryption key (see uploadHash) rather
+// than an MD5 hash. The hash is empty if it wasn't recorded. Sizes of encrypted objects without a
+// recorded size are computed from their ciphertext; other objects without one have their stored
+// size returned.
+func uploadedData(head *s3.HeadObjectOutput) (size int64, hash string, keyed bool) {
+	hash, keyed = head.Metadata[plaintextHMACKey], true
+	if hash == "" {
+		hash, keyed = head.Metadata[plaintextMD5Key], false
+	}
+	if size, err := strconv.ParseInt(head.Metadata[plaintextSizeKey], 10, 64); err == nil {
+		return size, hash, keyed
+	}
+	size = aws.ToInt64(head.ContentLength)
+	if isEncrypted(head.Metadata) && objectCompression(head.Metadata) == "" {
+		size = plaintextSize(size)
+	}
+	return size, hash, keyed
+}
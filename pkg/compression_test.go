@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// compressedObject compresses data like an upload with the given options, returning the fetched
+// object it would be read back as.
+func compressedObject(t *testing.T, data []byte, opts PutOptions) (*s3.GetObjectOutput, PutOptions) {
+	t.Helper()
+	var stored bytes.Buffer
+	if err := (&R2Client{}).compressPut(&stored, bytes.NewReader(data), &opts); err != nil {
+		t.Fatal(err)
+	}
+	return &s3.GetObjectOutput{
+		Body:            io.NopCloser(bytes.NewReader(stored.Bytes())),
+		ContentEncoding: aws.String(opts.ContentEncoding),
+		ContentLength:   aws.Int64(int64(stored.Len())),
+		Metadata:        opts.Metadata,
+	}, opts
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("compressible log line\n", 1000))
+	hash := md5.Sum(data)
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			obj, opts := compressedObject(t, data, PutOptions{Compress: compression, Metadata: map[string]string{"owner": "ops"}})
+
+			if opts.Compress != "" || opts.ContentEncoding != compression {
+				t.Errorf("Compress = %q, ContentEncoding = %q, want \"\" and %q", opts.Compress, opts.ContentEncoding, compression)
+			}
+			want := map[string]string{
+				"owner":                "ops",
+				compressionMetadataKey: compression,
+				plaintextSizeKey:       strconv.Itoa(len(data)),
+				plaintextMD5Key:        hex.EncodeToString(hash[:]),
+			}
+			for key, value := range want {
+				if opts.Metadata[key] != value {
+					t.Errorf("metadata %s = %q, want %q", key, opts.Metadata[key], value)
+				}
+			}
+			if aws.ToInt64(obj.ContentLength) >= int64(len(data)) {
+				t.Errorf("compressed size %d isn't smaller than %d", aws.ToInt64(obj.ContentLength), len(data))
+			}
+
+			if err := decompressGet(obj, "r2://bucket/key", false); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(obj.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("decompressed data differs")
+			}
+			if aws.ToInt64(obj.ContentLength) != int64(len(data)) {
+				t.Errorf("ContentLength = %d, want %d", aws.ToInt64(obj.ContentLength), len(data))
+			}
+
+			size, recorded, keyed := uploadedData(&s3.HeadObjectOutput{
+				ContentEncoding: obj.ContentEncoding,
+				ContentLength:   aws.Int64(1),
+				Metadata:        opts.Metadata,
+			})
+			if size != int64(len(data)) || recorded != hex.EncodeToString(hash[:]) || keyed {
+				t.Errorf("uploadedData = %d, %q, %v, want %d, %q, false", size, recorded, keyed, len(data), hex.EncodeToString(hash[:]))
+			}
+		})
+	}
+}
+
+func TestCompressPutContentEncoding(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentEncoding string
+		wantErr         bool
+	}{
+		{name: "unset"},
+		{name: "same as the compression", contentEncoding: "GZIP"},
+		{name: "another encoding", contentEncoding: "br", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := PutOptions{Compress: CompressionGzip, ContentEncoding: tt.contentEncoding}
+			err := (&R2Client{}).compressPut(io.Discard, strings.NewReader("data"), &opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compressPut error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecompressGet(t *testing.T) {
+	// A gzip file uploaded with its Content-Encoding set by other means
+	var foreign bytes.Buffer
+	writer := gzip.NewWriter(&foreign)
+	writer.Write([]byte("pre-compressed"))
+	writer.Close()
+
+	tests := []struct {
+		name     string
+		object   func(t *testing.T) *s3.GetObjectOutput
+		ranged   bool
+		wantErr  bool
+		wantBody []byte
+	}{
+		{
+			name: "ranged read of a compressed object",
+			object: func(t *testing.T) *s3.GetObjectOutput {
+				obj, _ := compressedObject(t, []byte("data"), PutOptions{Compress: CompressionZstd})
+				return obj
+			},
+			ranged:  true,
+			wantErr: true,
+		},
+		{
+			name: "foreign object with a gzip Content-Encoding",
+			object: func(t *testing.T) *s3.GetObjectOutput {
+				return &s3.GetObjectOutput{
+					Body:            io.NopCloser(bytes.NewReader(foreign.Bytes())),
+					ContentEncoding: aws.String("gzip"),
+				}
+			},
+			wantBody: foreign.Bytes(),
+		},
+		{
+			name: "ranged read of a foreign object",
+			object: func(t *testing.T) *s3.GetObjectOutput {
+				return &s3.GetObjectOutput{
+					Body:            io.NopCloser(bytes.NewReader(foreign.Bytes()[:4])),
+					ContentEncoding: aws.String("gzip"),
+				}
+			},
+			ranged:   true,
+			wantBody: foreign.Bytes()[:4],
+		},
+		{
+			name: "uncompressed object",
+			object: func(t *testing.T) *s3.GetObjectOutput {
+				return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("plain"))}
+			},
+			wantBody: []byte("plain"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := tt.object(t)
+			err := decompressGet(obj, "r2://bucket/key", tt.ranged)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("decompressGet succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(obj.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.wantBody) {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestIsTransformed(t *testing.T) {
+	tests := []struct {
+		name string
+		head *s3.HeadObjectOutput
+		want bool
+	}{
+		{"plain", &s3.HeadObjectOutput{}, false},
+		{"foreign gzip", &s3.HeadObjectOutput{ContentEncoding: aws.String("gzip")}, false},
+		{"compressed", &s3.HeadObjectOutput{
+			ContentEncoding: aws.String("zstd"),
+			Metadata:        map[string]string{compressionMetadataKey: CompressionZstd},
+		}, true},
+		{"encrypted", &s3.HeadObjectOutput{Metadata: map[string]string{encryptionMetadataKey: encryptionScheme}}, true},
+	}
+	for _, tt := range tests {
+		if got := isTransformed(tt.head); got != tt.want {
+			t.Errorf("%s: isTransformed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
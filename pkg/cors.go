@@ -0,0 +1,271 @@
+// Bucket CORS rules
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxCORSRules is the largest number of CORS rules a bucket may have.
+const maxCORSRules = 100
+
+// corsMethods are the HTTP methods CORS rules may allow.
+var corsMethods = []string{"GET", "PUT", "POST", "DELETE", "HEAD"}
+
+// CORSConfig is a bucket's CORS configuration, as read from and written to rule files.
+type CORSConfig struct {
+	Rules []CORSRule `json:"rules" yaml:"rules"`
+}
+
+// CORSRule is a CORS rule allowing browsers on AllowedOrigins to make requests with AllowedMethods
+// and AllowedHeaders to a bucket. Origins and headers may contain a single * wildcard matching any
+// characters, e.g. https://*.example.com. ExposeHeaders lists the response headers scripts may read,
+// and MaxAgeSeconds how long browsers may cache the result of a preflight request.
+type CORSRule struct {
+	ID             string   `json:"id,omitempty" yaml:"id,omitempty"`
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods" yaml:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty" yaml:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"exposeHeaders,omitempty" yaml:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  int32    `json:"maxAgeSeconds,omitempty" yaml:"maxAgeSeconds,omitempty"`
+}
+
+// ParseCORSConfig parses a CORS configuration from a JSON or YAML rule file and validates it. Files
+// without any rules are rejected; RemoveCORS removes a bucket's rules.
+func ParseCORSConfig(data []byte) (CORSConfig, error) {
+	var config CORSConfig
+	if err := decodeRuleFile(data, &config); err != nil {
+		return config, err
+	}
+	if len(config.Rules) == 0 {
+		return config, errors.New("the rule file has no rules")
+	}
+	return config, config.Validate()
+}
+
+// Validate checks that a CORS configuration can be applied to a bucket, returning an error
+// describing every invalid rule.
+func (c CORSConfig) Validate() error {
+	if len(c.Rules) > maxCORSRules {
+		return fmt.Errorf("too many rules: a bucket may have at most %d", maxCORSRules)
+	}
+
+	var errs []error
+	for i, rule := range c.Rules {
+		// Identify rules by ID where possible, or by their position otherwise
+		name := fmt.Sprintf("rule %d", i+1)
+		if rule.ID != "" {
+			name = fmt.Sprintf("rule %q", rule.ID)
+		}
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+
+		if len(rule.AllowedOrigins) == 0 {
+			invalid("allowedOrigins is required")
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if strings.Count(origin, "*") > 1 {
+				invalid("origin %q may contain at most one * wildcard", origin)
+			}
+		}
+		if len(rule.AllowedMethods) == 0 {
+			invalid("allowedMethods is required")
+		}
+		for _, method := range rule.AllowedMethods {
+			if !Contains(corsMethods, method) {
+				invalid("unsupported method %q: must be one of %s", method, strings.Join(corsMethods, ", "))
+			}
+		}
+		for _, header := range rule.AllowedHeaders {
+			if strings.Count(header, "*") > 1 {
+				invalid("header %q may contain at most one * wildcard", header)
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			invalid("maxAgeSeconds must be positive")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// wildcardMatch reports whether s matches a pattern containing at most one * wildcard, which matches
+// any sequence of characters.
+func wildcardMatch(pattern, s string) bool {
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == s
+	}
+	return len(s) >= len(prefix)+len(suffix) && strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
+
+// allows reports whether a rule allows a request from origin using method with the given request
+// headers. Header names are compared irrespective of case, as in HTTP.
+func (r CORSRule) allows(origin, method string, headers []string) bool {
+	originAllowed := false
+	for _, allowed := range r.AllowedOrigins {
+		if wildcardMatch(allowed, origin) {
+			originAllowed = true
+			break
+		}
+	}
+	if !originAllowed || !Contains(r.AllowedMethods, method) {
+		return false
+	}
+
+	for _, header := range headers {
+		headerAllowed := false
+		for _, allowed := range r.AllowedHeaders {
+			if wildcardMatch(strings.ToLower(allowed), strings.ToLower(header)) {
+				headerAllowed = true
+				break
+			}
+		}
+		if !headerAllowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluate simulates a CORS request from origin using method with the given request headers,
+// returning the first rule allowing it and the CORS headers a response to it would carry. If no rule
+// allows the request, the returned rule is nil and browsers would block the request.
+func (c CORSConfig) Evaluate(origin, method string, headers []string) (*CORSRule, map[string]string) {
+	method = strings.ToUpper(method)
+	for i, rule := range c.Rules {
+		if !rule.allows(origin, method, headers) {
+			continue
+		}
+
+		response := map[string]string{
+			"Access-Control-Allow-Origin":  origin,
+			"Access-Control-Allow-Methods": strings.Join(rule.AllowedMethods, ", "),
+		}
+		if len(headers) > 0 {
+			response["Access-Control-Allow-Headers"] = strings.Join(headers, ", ")
+		}
+		if len(rule.ExposeHeaders) > 0 {
+			response["Access-Control-Expose-Headers"] = strings.Join(rule.ExposeHeaders, ", ")
+		}
+		if rule.MaxAgeSeconds > 0 {
+			response["Access-Control-Max-Age"] = strconv.Itoa(int(rule.MaxAgeSeconds))
+		}
+		return &c.Rules[i], response
+	}
+	return nil, nil
+}
+
+// GetCORS returns a bucket's CORS configuration. Buckets without CORS rules return an empty
+// configuration.
+func (b *R2Bucket) GetCORS() (CORSConfig, error) {
+	output, err := b.Client.GetBucketCors(context.TODO(), &s3.GetBucketCorsInput{
+		Bucket: &b.Name,
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchCORSConfiguration" {
+		return CORSConfig{}, nil
+	} else if err != nil {
+		return CORSConfig{}, err
+	}
+
+	var config CORSConfig
+	for _, rule := range output.CORSRules {
+		config.Rules = append(config.Rules, CORSRule{
+			ID:             aws.ToString(rule.ID),
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+			MaxAgeSeconds:  aws.ToInt32(rule.MaxAgeSeconds),
+		})
+	}
+	return config, nil
+}
+
+// PutCORS validates a CORS configuration and applies it to a bucket, replacing its existing rules.
+func (b *R2Bucket) PutCORS(config CORSConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if len(config.Rules) == 0 {
+		return b.RemoveCORS()
+	}
+
+	var rules []types.CORSRule
+	for _, rule := range config.Rules {
+		corsRule := types.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+		}
+		if rule.ID != "" {
+			corsRule.ID = aws.String(rule.ID)
+		}
+		if rule.MaxAgeSeconds > 0 {
+			corsRule.MaxAgeSeconds = aws.Int32(rule.MaxAgeSeconds)
+		}
+		rules = append(rules, corsRule)
+	}
+	_, err := b.Client.PutBucketCors(context.TODO(), &s3.PutBucketCorsInput{
+		Bucket:            &b.Name,
+		CORSConfiguration: &types.CORSConfiguration{CORSRules: rules},
+	})
+	return err
+}
+
+// RemoveCORS removes all CORS rules from a bucket.
+func (b *R2Bucket) RemoveCORS() error {
+	_, err := b.Client.DeleteBucketCors(context.TODO(), &s3.DeleteBucketCorsInput{
+		Bucket: &b.Name,
+	})
+	return err
+}
+
+// PrintCORS prints a human-readable description of a bucket's CORS rules.
+func (b *R2Bucket) PrintCORS() error {
+	config, err := b.GetCORS()
+	if err != nil {
+		return err
+	}
+	if len(config.Rules) == 0 {
+		fmt.Printf("r2://%s has no CORS rules\n", b.Name)
+		return nil
+	}
+
+	for i, rule := range config.Rules {
+		// Separate rules with a blank line
+		if i > 0 {
+			fmt.Println()
+		}
+
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("Rule %d", i+1)
+		}
+		fmt.Println(name)
+		fmt.Printf("  Origins:         %s\n", strings.Join(rule.AllowedOrigins, ", "))
+		fmt.Printf("  Methods:         %s\n", strings.Join(rule.AllowedMethods, ", "))
+		if len(rule.AllowedHeaders) > 0 {
+			fmt.Printf("  Headers:         %s\n", strings.Join(rule.AllowedHeaders, ", "))
+		}
+		if len(rule.ExposeHeaders) > 0 {
+			fmt.Printf("  Expose headers:  %s\n", strings.Join(rule.ExposeHeaders, ", "))
+		}
+		if rule.MaxAgeSeconds > 0 {
+			fmt.Printf("  Max age:         %ds\n", rule.MaxAgeSeconds)
+		}
+	}
+	return nil
+}
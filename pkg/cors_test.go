@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://example.org", false},
+		{"*", "", true},
+		{"*", "https://example.com", true},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"x-amz-*", "x-amz-date", true},
+		{"x-amz-*", "x-amz-", true},
+		{"x-amz-*", "x-am", false},
+		// The prefix and suffix mustn't overlap
+		{"ab*ba", "aba", false},
+		{"ab*ba", "abba", true},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCORSConfigEvaluate(t *testing.T) {
+	config := CORSConfig{Rules: []CORSRule{
+		{
+			ID:             "uploads",
+			AllowedOrigins: []string{"https://app.example.com"},
+			AllowedMethods: []string{"PUT", "POST"},
+			AllowedHeaders: []string{"Content-Type", "x-amz-*"},
+			MaxAgeSeconds:  600,
+		},
+		{
+			ID:             "public",
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "HEAD"},
+			ExposeHeaders:  []string{"ETag"},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		origin   string
+		method   string
+		headers  []string
+		wantRule string
+		wantHdrs map[string]string
+	}{
+		{
+			name:     "first matching rule wins",
+			origin:   "https://app.example.com",
+			method:   "put",
+			headers:  []string{"content-type", "X-Amz-Date"},
+			wantRule: "uploads",
+			wantHdrs: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "PUT, POST",
+				"Access-Control-Allow-Headers": "content-type, X-Amz-Date",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:     "wildcard origin",
+			origin:   "https://other.example.org",
+			method:   "GET",
+			wantRule: "public",
+			wantHdrs: map[string]string{
+				"Access-Control-Allow-Origin":   "https://other.example.org",
+				"Access-Control-Allow-Methods":  "GET, HEAD",
+				"Access-Control-Expose-Headers": "ETag",
+			},
+		},
+		{
+			name:   "method not allowed for origin",
+			origin: "https://other.example.org",
+			method: "PUT",
+		},
+		{
+			name:    "header not allowed",
+			origin:  "https://app.example.com",
+			method:  "PUT",
+			headers: []string{"Authorization"},
+		},
+		{
+			name:    "headers not allowed by rule without allowed headers",
+			origin:  "https://other.example.org",
+			method:  "GET",
+			headers: []string{"Range"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, headers := config.Evaluate(tt.origin, tt.method, tt.headers)
+			if tt.wantRule == "" {
+				if rule != nil {
+					t.Fatalf("Evaluate allowed the request with rule %q, want no rule", rule.ID)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatalf("Evaluate allowed no rule, want %q", tt.wantRule)
+			}
+			if rule.ID != tt.wantRule {
+				t.Errorf("rule = %q, want %q", rule.ID, tt.wantRule)
+			}
+			if len(headers) != len(tt.wantHdrs) {
+				t.Errorf("headers = %v, want %v", headers, tt.wantHdrs)
+			}
+			for name, want := range tt.wantHdrs {
+				if headers[name] != want {
+					t.Errorf("%s = %q, want %q", name, headers[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCORSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		rules   int
+		wantErr string
+	}{
+		{
+			name:  "YAML",
+			data:  "rules:\n  - allowedOrigins: [\"*\"]\n    allowedMethods: [GET]\n",
+			rules: 1,
+		},
+		{
+			name:  "JSON",
+			data:  `{"rules": [{"allowedOrigins": ["*"], "allowedMethods": ["GET", "HEAD"]}]}`,
+			rules: 1,
+		},
+		{name: "empty file", data: "", wantErr: "empty"},
+		{name: "whitespace only", data: "\n  \n", wantErr: "empty"},
+		{name: "no rules", data: "rules: []\n", wantErr: "no rules"},
+		{
+			name:    "unknown field",
+			data:    "rules:\n  - allowedOrigin: [\"*\"]\n    allowedMethods: [GET]\n",
+			wantErr: "allowedOrigin",
+		},
+		{
+			name:    "invalid method",
+			data:    "rules:\n  - allowedOrigins: [\"*\"]\n    allowedMethods: [PATCH]\n",
+			wantErr: "unsupported method",
+		},
+		{
+			name:    "two wildcards",
+			data:    "rules:\n  - allowedOrigins: [\"https://*.*.com\"]\n    allowedMethods: [GET]\n",
+			wantErr: "at most one",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseCORSConfig([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseCORSConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCORSConfig: %v", err)
+			}
+			if len(config.Rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(config.Rules), tt.rules)
+			}
+		})
+	}
+}
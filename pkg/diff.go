@@ -0,0 +1,388 @@
+// Location comparison
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultResolveConcurrency is the number of objects whose metadata is looked up in parallel when
+// comparing objects compressed or encrypted client-side.
+const defaultResolveConcurrency = 8
+
+// DiffStatus describes how a path differs between the source and destination of a comparison.
+type DiffStatus string
+
+const (
+	// DiffOnlyInSource is used for paths that exist in the source but not the destination
+	DiffOnlyInSource DiffStatus = "only-in-source"
+	// DiffOnlyInDest is used for paths that exist in the destination but not the source
+	DiffOnlyInDest DiffStatus = "only-in-dest"
+	// DiffChanged is used for paths whose contents differ between the source and destination
+	DiffChanged DiffStatus = "changed"
+	// DiffUnchanged is used for paths whose contents are the same in the source and destination
+	DiffUnchanged DiffStatus = "unchanged"
+)
+
+// Reasons changed paths are considered to differ, in the order they're checked.
+const (
+	// DiffReasonSize is used when the source and destination sizes differ
+	DiffReasonSize = "size"
+	// DiffReasonHash is used when the source and destination MD5 hashes differ
+	DiffReasonHash = "hash"
+	// DiffReasonMtime is used when the hashes can't be compared, because either side was uploaded in
+	// multiple parts or compressed or encrypted without recording its hash, and the source was
+	// modified after the destination
+	DiffReasonMtime = "mtime"
+)
+
+// DiffEntry is a path compared between the source and destination of a diff or sync. Path is
+// relative to the compared directories or prefixes, using "/" as a separator. Reason is set for
+// changed paths to one of the DiffReason constants.
+type DiffEntry struct {
+	Path   string     `json:"path"`
+	Status DiffStatus `json:"status"`
+	Reason string     `json:"reason,omitempty"`
+
+	// source and dest are the entries compared, or nil if the path doesn't exist on that side
+	source *syncEntry
+	dest   *syncEntry
+}
+
+// syncEntry is a local file or R2 object at one end of a comparison. Path holds the file's path or
+// the object's key. Local files have no ETag; their MD5 hash is computed when first needed. Objects
+// compressed or encrypted client-side have the size and hash of the data uploaded to them once
+// resolved with resolveUploaded; noHash is set for those whose hash isn't known, and keyed for those
+// whose hash is an HMAC (see uploadHash). sseKey is the SSE-C key objects are read with, if any.
+type syncEntry struct {
+	path     string
+	size     int64
+	modified time.Time
+	etag     string
+	noHash   bool
+	keyed    bool
+	object   *types.Object
+	bucket   *R2Bucket
+	sseKey   []byte
+}
+
+// hash returns the MD5 hash of a local file, or the ETag of an object.
+func (e *syncEntry) hash() string {
+	if e.object == nil && e.etag == "" {
+		e.etag = md5sum(e.path)
+	}
+	return e.etag
+}
+
+// hashable reports whether the entry's hash is the MD5 hash of its contents. Objects uploaded in
+// multiple parts have ETags computed from their parts instead, and objects compressed or encrypted
+// client-side may not have the hash of the data uploaded to them recorded.
+func (e *syncEntry) hashable() bool {
+	return !e.noHash && !isMultipartETag(e.etag)
+}
+
+// resolveUploaded replaces the size and hash of an object compressed or encrypted client-side with
+// those of the data uploaded to it, as recorded in its metadata. Other objects are left unchanged.
+func (e *syncEntry) resolveUploaded() error {
+	head, err := e.bucket.StatWithOptions(e.path, GetOptions{SSECustomerKey: e.sseKey})
+	if err != nil {
+		return err
+	}
+	if !isTransformed(head) {
+		return nil
+	}
+	e.size, e.etag, e.keyed = uploadedData(head)
+	e.noHash = e.etag == ""
+	return nil
+}
+
+// matchHashes makes the hashes of two entries comparable when one of them is an object whose hash is
+// an HMAC, by replacing the hash of a local file on the other side with its HMAC under the key of
+// the object's client. It reports whether the hashes are comparable: objects can't be rehashed, and
+// clients without an encryption key can't compute HMACs.
+func matchHashes(source, dest *syncEntry) bool {
+	if source.keyed == dest.keyed {
+		return true
+	}
+	local, keyed := source, dest
+	if source.keyed {
+		local, keyed = dest, source
+	}
+	if local.object != nil || keyed.bucket == nil || keyed.bucket.Client.encryptionKey == nil {
+		return false
+	}
+	local.etag = hashsum(local.path, plaintextHMAC(keyed.bucket.Client.encryptionKey))
+	local.keyed = true
+	return true
+}
+
+// isMultipartETag reports whether an ETag is that of an object uploaded in multiple parts, which
+// isn't the MD5 hash of the object's contents.
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
+
+// compareSyncEntries compares the source and destination entries of a path, returning the reason
+// they differ, or "" if they're the same. Sizes are compared first, then hashes. If either side's
+// hash isn't a hash of its contents comparable with the other side's (see hashable and matchHashes)
+// and the hashes differ, the entries are considered to differ only if the source was modified after
+// the destination. Objects compressed or encrypted client-side must already have been resolved by
+// resolveSyncEntries.
+func compareSyncEntries(source, dest *syncEntry) string {
+	if source.size != dest.size {
+		return DiffReasonSize
+	}
+
+	// Check ETags already known before hashing local files, as the hashes may not be needed
+	if !source.hashable() || !dest.hashable() || !matchHashes(source, dest) {
+		if source.etag == dest.etag || !source.modified.After(dest.modified) {
+			return ""
+		}
+		return DiffReasonMtime
+	}
+	if source.hash() != dest.hash() {
+		return DiffReasonHash
+	}
+	return ""
+}
+
+// resolveSyncEntries resolves the objects paired with entries of a different size with
+// resolveUploaded, so objects compressed or encrypted client-side are compared by the data uploaded
+// to them. This costs a request per object, made defaultResolveConcurrency at a time. Objects of the
+// same size as their pair aren't resolved; if they were transformed, their hashes differ instead.
+func resolveSyncEntries(entries []DiffEntry) error {
+	var resolve []*syncEntry
+	var paths []string
+	for _, entry := range entries {
+		if entry.source == nil || entry.dest == nil || entry.source.size == entry.dest.size {
+			continue
+		}
+		for _, e := range []*syncEntry{entry.source, entry.dest} {
+			if e.bucket != nil {
+				resolve = append(resolve, e)
+				paths = append(paths, entry.Path)
+			}
+		}
+	}
+
+	errs := make([]error, len(resolve))
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, defaultResolveConcurrency)
+	for i, e := range resolve {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, e *syncEntry) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			errs[i] = e.resolveUploaded()
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("couldn't compare %s: %w", paths[i], err)
+		}
+	}
+	return nil
+}
+
+// pairSyncEntries pairs source and destination entries, keyed by relative path, returning an entry
+// for every path on either side, sorted by path. Paths on both sides are left without a status until
+// they're compared.
+func pairSyncEntries(source, dest map[string]*syncEntry) []DiffEntry {
+	var entries []DiffEntry
+	for path, s := range source {
+		entry := DiffEntry{Path: path, Status: DiffOnlyInSource, source: s}
+		if d, ok := dest[path]; ok {
+			entry.Status = ""
+			entry.dest = d
+		}
+		entries = append(entries, entry)
+	}
+	for path, d := range dest {
+		if _, ok := source[path]; !ok {
+			entries = append(entries, DiffEntry{Path: path, Status: DiffOnlyInDest, dest: d})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// diffSyncEntries compares source and destination entries, keyed by relative path, returning an
+// entry for every path on either side, sorted by path.
+func diffSyncEntries(source, dest map[string]*syncEntry) ([]DiffEntry, error) {
+	entries := pairSyncEntries(source, dest)
+	if err := resolveSyncEntries(entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.source == nil || entry.dest == nil {
+			continue
+		}
+		entry.Reason = compareSyncEntries(entry.source, entry.dest)
+		entry.Status = DiffUnchanged
+		if entry.Reason != "" {
+			entry.Status = DiffChanged
+		}
+	}
+	return entries, nil
+}
+
+// localSyncEntries returns the files in a local directory and its subdirectories, keyed by their
+// paths relative to the directory, using "/" as a separator.
+func localSyncEntries(dir string) (map[string]*syncEntry, error) {
+	if !isDir(dir) {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	entries := make(map[string]*syncEntry)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries[filepath.ToSlash(relativePath)] = &syncEntry{path: path, size: info.Size(), modified: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+// objectSyncEntries returns the objects with the specified prefix, keyed by their keys relative to
+// the prefix. Directory markers (keys ending in "/") are skipped, as they have no local equivalent.
+// sseKey is the SSE-C key the objects are read with, if they're encrypted with one.
+func (b *R2Bucket) objectSyncEntries(prefix string, sseKey []byte) (map[string]*syncEntry, error) {
+	entries := make(map[string]*syncEntry)
+	err := b.WalkObjectsWithPrefix(prefix, func(object types.Object) error {
+		key := aws.ToString(object.Key)
+		if strings.HasSuffix(key, "/") {
+			return nil
+		}
+		entries[strings.TrimPrefix(key, prefix)] = &syncEntry{
+			path:     key,
+			size:     aws.ToInt64(object.Size),
+			modified: aws.ToTime(object.LastModified),
+			etag:     strings.Trim(aws.ToString(object.ETag), `"`),
+			object:   &object,
+			bucket:   b,
+			sseKey:   sseKey,
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// dirPrefix ensures a non-empty prefix ends with "/", so that it's treated as a directory.
+func dirPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+	return prefix
+}
+
+// diffLocalToR2 compares a local directory to the objects with a prefix, read with the given SSE-C
+// key, returning every path in either, including unchanged ones.
+func (b *R2Bucket) diffLocalToR2(sourcePath string, prefix string, sseKey []byte) ([]DiffEntry, error) {
+	source, err := localSyncEntries(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := b.objectSyncEntries(dirPrefix(prefix), sseKey)
+	if err != nil {
+		return nil, err
+	}
+	return diffSyncEntries(source, dest)
+}
+
+// diffR2ToLocal compares the objects with a prefix, read with the given SSE-C key, to a local
+// directory, returning every path in either, including unchanged ones.
+func (b *R2Bucket) diffR2ToLocal(destinationPath string, prefix string, sseKey []byte) ([]DiffEntry, error) {
+	source, err := b.objectSyncEntries(dirPrefix(prefix), sseKey)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := localSyncEntries(destinationPath)
+	if err != nil {
+		return nil, err
+	}
+	return diffSyncEntries(source, dest)
+}
+
+// diffR2ToR2 compares the objects with a prefix to the objects with a prefix in another bucket,
+// each read with the given SSE-C key, returning every path in either, including unchanged ones.
+func (b *R2Bucket) diffR2ToR2(destBucket R2Bucket, sourcePrefix string, destPrefix string, sourceSSEKey, destSSEKey []byte) ([]DiffEntry, error) {
+	source, err := b.objectSyncEntries(dirPrefix(sourcePrefix), sourceSSEKey)
+	if err != nil {
+		return nil, err
+	}
+	dest, err := destBucket.objectSyncEntries(dirPrefix(destPrefix), destSSEKey)
+	if err != nil {
+		return nil, err
+	}
+	return diffSyncEntries(source, dest)
+}
+
+// differences filters out unchanged entries.
+func differences(entries []DiffEntry, err error) ([]DiffEntry, error) {
+	var diff []DiffEntry
+	for _, entry := range entries {
+		if entry.Status != DiffUnchanged {
+			diff = append(diff, entry)
+		}
+	}
+	return diff, err
+}
+
+// DiffLocalToR2 compares a local directory to the objects with a prefix in an R2 bucket, using the
+// same comparison as SyncLocalToR2WithOptions, without transferring anything. It returns the paths
+// that differ, sorted by path; an empty result means a sync would upload nothing.
+func (b *R2Bucket) DiffLocalToR2(sourcePath string, prefix string) ([]DiffEntry, error) {
+	return differences(b.diffLocalToR2(sourcePath, prefix, nil))
+}
+
+// DiffR2ToLocal compares the objects with a prefix in an R2 bucket to a local directory, using the
+// same comparison as SyncR2ToLocalWithOptions, without transferring anything. It returns the paths
+// that differ, sorted by path.
+func (b *R2Bucket) DiffR2ToLocal(destinationPath string, prefix string) ([]DiffEntry, error) {
+	return differences(b.diffR2ToLocal(destinationPath, prefix, nil))
+}
+
+// DiffR2ToR2 compares the objects with a prefix in an R2 bucket to the objects with a prefix in
+// another bucket, using the same comparison as SyncR2ToR2WithOptions, without transferring anything.
+// It returns the paths that differ, sorted by path.
+func (b *R2Bucket) DiffR2ToR2(destBucket R2Bucket, sourcePrefix string, destPrefix string) ([]DiffEntry, error) {
+	return differences(b.diffR2ToR2(destBucket, sourcePrefix, destPrefix, nil, nil))
+}
+
+// PrintDiff prints the entries of a diff, one per line, marking paths only in the source with "+",
+// paths only in the destination with "-" and changed paths with "~", followed by the reason they
+// differ.
+func PrintDiff(entries []DiffEntry) {
+	for _, entry := range entries {
+		switch entry.Status {
+		case DiffOnlyInSource:
+			fmt.Printf("+ %s\n", entry.Path)
+		case DiffOnlyInDest:
+			fmt.Printf("- %s\n", entry.Path)
+		case DiffChanged:
+			fmt.Printf("~ %s (%s)\n", entry.Path, entry.Reason)
+		}
+	}
+}
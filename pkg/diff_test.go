@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// localEntry writes a local file with the given contents and returns its entry, modified at the
+// given time.
+func localEntry(t *testing.T, contents string, modified time.Time) *syncEntry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &syncEntry{path: path, size: int64(len(contents)), modified: modified}
+}
+
+// objectEntry returns the entry of an object with the given contents, as listed, modified at the
+// given time. An ETag other than "" replaces the MD5 hash of the contents.
+func objectEntry(contents, etag string, modified time.Time) *syncEntry {
+	if etag == "" {
+		hash := md5.Sum([]byte(contents))
+		etag = hex.EncodeToString(hash[:])
+	}
+	return &syncEntry{path: "key", size: int64(len(contents)), modified: modified, etag: etag, object: &types.Object{}}
+}
+
+// encryptedEntry returns the entry of an object encrypted client-side with the given contents, as
+// resolved, read by a client with the given encryption key, which may be nil.
+func encryptedEntry(contents string, key []byte, modified time.Time) *syncEntry {
+	h := plaintextHMAC(testEncryptionKey)()
+	h.Write([]byte(contents))
+	e := objectEntry(contents, hex.EncodeToString(h.Sum(nil)), modified)
+	e.keyed = true
+	e.bucket = &R2Bucket{Client: &R2Client{encryptionKey: key}}
+	return e
+}
+
+func TestCompareSyncEntries(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	multipartETag := "9b2cf535f27731c974343645a3985328-2"
+
+	tests := []struct {
+		name   string
+		source func(t *testing.T) *syncEntry
+		dest   func(t *testing.T) *syncEntry
+		want   string
+	}{
+		{
+			name:   "same contents",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", newer) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", "", older) },
+			want:   "",
+		},
+		{
+			name:   "different size",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello!", older) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", "", newer) },
+			want:   DiffReasonSize,
+		},
+		{
+			name:   "same size, different contents",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", older) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("world", "", newer) },
+			want:   DiffReasonHash,
+		},
+		{
+			name:   "multipart object, source newer",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", newer) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", multipartETag, older) },
+			want:   DiffReasonMtime,
+		},
+		{
+			name:   "multipart object, source older",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", older) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", multipartETag, newer) },
+			want:   "",
+		},
+		{
+			name:   "same multipart ETag between objects",
+			source: func(t *testing.T) *syncEntry { return objectEntry("hello", multipartETag, newer) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", multipartETag, older) },
+			want:   "",
+		},
+		{
+			name:   "object without a recorded hash, source newer",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", newer) },
+			dest: func(t *testing.T) *syncEntry {
+				e := objectEntry("hello", "", older)
+				e.noHash = true
+				return e
+			},
+			want: DiffReasonMtime,
+		},
+		{
+			name:   "objects with the same ETag",
+			source: func(t *testing.T) *syncEntry { return objectEntry("hello", "", newer) },
+			dest:   func(t *testing.T) *syncEntry { return objectEntry("hello", "", older) },
+			want:   "",
+		},
+		{
+			name:   "encrypted object with the same HMAC",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", newer) },
+			dest:   func(t *testing.T) *syncEntry { return encryptedEntry("hello", testEncryptionKey, older) },
+			want:   "",
+		},
+		{
+			name:   "encrypted object with a different HMAC",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", older) },
+			dest:   func(t *testing.T) *syncEntry { return encryptedEntry("world", testEncryptionKey, newer) },
+			want:   DiffReasonHash,
+		},
+		{
+			name:   "encrypted object without the key, source older",
+			source: func(t *testing.T) *syncEntry { return localEntry(t, "hello", older) },
+			dest:   func(t *testing.T) *syncEntry { return encryptedEntry("world", nil, newer) },
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareSyncEntries(tt.source(t), tt.dest(t)); got != tt.want {
+				t.Errorf("compareSyncEntries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSyncEntries(t *testing.T) {
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := map[string]*syncEntry{
+		"a.txt":     localEntry(t, "same", modified),
+		"b/c.txt":   localEntry(t, "changed", modified),
+		"new.txt":   localEntry(t, "new", modified),
+		"d/e/f.txt": localEntry(t, "same too", modified),
+	}
+	dest := map[string]*syncEntry{
+		"a.txt":     objectEntry("same", "", modified),
+		"b/c.txt":   objectEntry("changed!", "", modified),
+		"d/e/f.txt": objectEntry("same too", "", modified),
+		"old.txt":   objectEntry("old", "", modified),
+	}
+
+	entries, err := diffSyncEntries(source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Path   string
+		Status DiffStatus
+		Reason string
+	}
+	var got []result
+	for _, entry := range entries {
+		got = append(got, result{entry.Path, entry.Status, entry.Reason})
+	}
+	want := []result{
+		{"a.txt", DiffUnchanged, ""},
+		{"b/c.txt", DiffChanged, DiffReasonSize},
+		{"d/e/f.txt", DiffUnchanged, ""},
+		{"new.txt", DiffOnlyInSource, ""},
+		{"old.txt", DiffOnlyInDest, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSyncEntries =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestDirPrefix(t *testing.T) {
+	tests := map[string]string{
+		"":      "",
+		"logs":  "logs/",
+		"logs/": "logs/",
+		"a/b":   "a/b/",
+	}
+	for prefix, want := range tests {
+		if got := dirPrefix(prefix); got != want {
+			t.Errorf("dirPrefix(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
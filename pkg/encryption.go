@@ -0,0 +1,480 @@
+// Client-side encryption
+
+package pkg
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Objects are encrypted client-side with AES-256-GCM in chunks, using the STREAM construction: each
+// chunk of up to encryptionChunkSize bytes of plaintext is sealed separately, with a nonce made of
+// the chunk's index and a flag marking the final chunk. Chunks can't be reordered, dropped or
+// truncated without failing authentication, and objects of any size can be encrypted and decrypted
+// as streams. Each object is encrypted with its own key, derived with HKDF-SHA256 from the client's
+// key and a random salt chosen per object, so nonces are never reused under the same key, however
+// many objects are encrypted.
+//
+// Encrypted objects start with a header holding encryptionMagic and the salt, and are marked with
+// the encryptionMetadataKey user metadata key. The size of the plaintext and its HMAC-SHA256, under
+// another key derived from the client's key, are recorded in the plaintextSizeKey and
+// plaintextHMACKey keys when known before the upload, so encrypted objects can be compared with
+// local files without downloading them. Unlike a plain hash, the HMAC doesn't let those able to read
+// the metadata confirm guesses of the contents.
+const (
+	encryptionMetadataKey = "r2-encryption"
+	encryptionScheme      = "aes-256-gcm-hkdf-stream-v2"
+	plaintextSizeKey      = "r2-size"
+	plaintextMD5Key       = "r2-md5"
+	plaintextHMACKey      = "r2-hmac"
+
+	// encryptionKeySize is the size of AES-256 keys in bytes.
+	encryptionKeySize = 32
+
+	// encryptionChunkSize is the size of each encrypted chunk's plaintext.
+	encryptionChunkSize = 64 * 1024
+
+	// encryptionSaltSize is the size of the random salt each object's key is derived from.
+	encryptionSaltSize = 32
+
+	// encryptionTagSize is the size of the authentication tag added to each chunk.
+	encryptionTagSize = 16
+
+	// objectKeyInfo and plaintextHMACInfo separate the keys derived from the client's key for
+	// encrypting objects and for computing plaintext HMACs.
+	objectKeyInfo     = "r2 object encryption key"
+	plaintextHMACInfo = "r2 plaintext hmac key"
+)
+
+// encryptionMagic identifies the header of encrypted objects and the version of their format.
+var encryptionMagic = []byte("R2E\x02")
+
+// encryptionHeaderSize is the size of the header of encrypted objects.
+var encryptionHeaderSize = int64(len(encryptionMagic) + encryptionSaltSize)
+
+// ErrDecryption is returned when reading an encrypted object fails authentication, because the
+// encryption key is wrong or the object has been corrupted or truncated.
+var ErrDecryption = errors.New("couldn't decrypt object: wrong encryption key, or corrupted or truncated data")
+
+// ParseEncryptionKey parses a 256-bit encryption key encoded in base64 or hex, e.g. as generated by
+// "openssl rand -base64 32". Surrounding whitespace is ignored.
+func ParseEncryptionKey(key string) ([]byte, error) {
+	text := strings.TrimSpace(key)
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption keys must be 32 bytes, encoded in base64 or hex")
+}
+
+// LoadEncryptionKey reads a 256-bit encryption key from a file, holding either the 32 raw bytes of
+// the key or the key encoded in base64 or hex.
+func LoadEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read encryption key: %w", err)
+	}
+	if len(data) == encryptionKeySize {
+		return data, nil
+	}
+	key, err := ParseEncryptionKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key in %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// deriveKey derives a 256-bit key from the client's key with HKDF-SHA256 (RFC 5869), using the
+// given salt, which may be nil, and info string separating keys used for different purposes.
+func deriveKey(key, salt []byte, info string) []byte {
+	// Extract a pseudorandom key, then expand it; a single block of output is a 256-bit key
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(key)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// newObjectAEAD returns the AES-GCM cipher of an object with the given salt, encrypted with the
+// client's key.
+func newObjectAEAD(key, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(key, salt, objectKeyInfo))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// plaintextHMAC returns a function creating the HMAC recorded for the plaintext of objects encrypted
+// with the client's key.
+func plaintextHMAC(key []byte) func() hash.Hash {
+	hmacKey := deriveKey(key, nil, plaintextHMACInfo)
+	return func() hash.Hash { return hmac.New(sha256.New, hmacKey) }
+}
+
+// chunkNonce returns the nonce of the chunk with the given index. Every object has its own key, so
+// nonces only need to be unique within an object: the first 7 bytes of the 12-byte GCM nonce are
+// zero, followed by the chunk index and the final chunk flag.
+func chunkNonce(index uint32, final bool) []byte {
+	nonce := make([]byte, 7, 12)
+	nonce = binary.BigEndian.AppendUint32(nonce, index)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// encryptedSize returns the size of an encrypted object with the given plaintext size. Every object
+// has at least one chunk, so that empty objects are authenticated too.
+func encryptedSize(size int64) int64 {
+	chunks := (size + encryptionChunkSize - 1) / encryptionChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return encryptionHeaderSize + size + chunks*encryptionTagSize
+}
+
+// encryptedChunkCount returns the number of chunks an encrypted object with the given plaintext
+// size has.
+func encryptedChunkCount(size int64) int64 {
+	return (encryptedSize(size) - encryptionHeaderSize - size) / encryptionTagSize
+}
+
+// encryptReader is a reader of the ciphertext of a plaintext reader. If the plaintext reader is
+// seekable, the encryptReader is seekable too: seeking re-encrypts the chunk containing the new
+// position, which is deterministic for a given salt, so the SDK can determine the body's length and
+// rewind it to retry requests.
+type encryptReader struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	header []byte
+
+	// size is the plaintext size, and start the plaintext reader's starting offset, if seekable
+	size  int64
+	start int64
+
+	// pos is the position in the ciphertext, and buf the ciphertext starting at bufStart
+	pos      int64
+	buf      []byte
+	bufStart int64
+
+	// next is the index of the next chunk read from a non-seekable reader, peek the reader used to
+	// detect its final chunk, and finished whether the final chunk has been read
+	next     int64
+	peek     *bufio.Reader
+	finished bool
+}
+
+// newEncryptReader returns a reader of the ciphertext of r, encrypted with key and a random salt.
+func newEncryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return newEncryptReaderWithSalt(r, key, salt)
+}
+
+// newEncryptReaderWithSalt returns a reader of the ciphertext of r, encrypted with key and the given
+// salt. Encrypting the same plaintext with the same key and salt produces the same ciphertext, so
+// objects can be checked against local files without being downloaded.
+func newEncryptReaderWithSalt(r io.Reader, key, salt []byte) (io.Reader, error) {
+	aead, err := newObjectAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encryptReader{src: r, aead: aead, header: append(append([]byte{}, encryptionMagic...), salt...), size: -1}
+	e.buf, e.bufStart = e.header, 0
+
+	// Seekable readers are encrypted a chunk at a time wherever they're read from
+	if size := readerSize(r); size >= 0 {
+		start, err := r.(io.Seeker).Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		e.size, e.start = size, start
+		return &encryptReadSeeker{e}, nil
+	}
+	e.peek = bufio.NewReader(r)
+	return e, nil
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	if e.pos < e.bufStart || e.pos >= e.bufStart+int64(len(e.buf)) {
+		if err := e.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.buf[e.pos-e.bufStart:])
+	e.pos += int64(n)
+	return n, nil
+}
+
+// fill encrypts the chunk containing the current position into the buffer, returning io.EOF past
+// the final chunk.
+func (e *encryptReader) fill() error {
+	if e.pos < encryptionHeaderSize {
+		e.buf, e.bufStart = e.header, 0
+		return nil
+	}
+
+	index := (e.pos - encryptionHeaderSize) / (encryptionChunkSize + encryptionTagSize)
+	chunk := make([]byte, encryptionChunkSize)
+	var n int
+	var final bool
+	if e.size >= 0 {
+		// Seek to the chunk's plaintext
+		if index >= encryptedChunkCount(e.size) {
+			return io.EOF
+		}
+		if _, err := e.src.(io.Seeker).Seek(e.start+index*encryptionChunkSize, io.SeekStart); err != nil {
+			return err
+		}
+		var err error
+		if n, err = io.ReadFull(e.src, chunk); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		final = index == encryptedChunkCount(e.size)-1
+	} else {
+		// Non-seekable readers can only be read in order, peeking to find the final chunk
+		if e.finished {
+			return io.EOF
+		}
+		if index != e.next {
+			return fmt.Errorf("non-seekable plaintext can only be encrypted in order")
+		}
+		var err error
+		n, err = io.ReadFull(e.peek, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if err == nil {
+			_, err = e.peek.Peek(1)
+		}
+		final = err != nil
+		e.finished = final
+		e.next++
+	}
+	if index > int64(^uint32(0)) {
+		return fmt.Errorf("object too large to encrypt")
+	}
+
+	e.buf = e.aead.Seal(nil, chunkNonce(uint32(index), final), chunk[:n], nil)
+	e.bufStart = encryptionHeaderSize + index*(encryptionChunkSize+encryptionTagSize)
+	if e.pos >= e.bufStart+int64(len(e.buf)) {
+		// The position is past the end of the final chunk
+		return io.EOF
+	}
+	return nil
+}
+
+// encryptReadSeeker is an encryptReader over a seekable reader, which remains seekable.
+type encryptReadSeeker struct {
+	*encryptReader
+}
+
+func (e *encryptReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += e.pos
+	case io.SeekEnd:
+		offset += encryptedSize(e.size)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek to negative position %d", offset)
+	}
+	e.pos = offset
+	return offset, nil
+}
+
+// decryptReader is a reader of the plaintext of an encrypted object's body. Reads fail with
+// ErrDecryption if any chunk fails authentication, including when the final chunk is missing.
+type decryptReader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	index uint32
+	buf   []byte
+	done  bool
+}
+
+// newDecryptReader returns a reader of the plaintext of r, an encrypted object's body, decrypted
+// with key.
+func newDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDecryption
+	}
+	salt, err := encryptionSalt(header)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newObjectAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{src: bufio.NewReader(r), aead: aead}, nil
+}
+
+// encryptionSalt returns the salt in the header of an encrypted object.
+func encryptionSalt(header []byte) ([]byte, error) {
+	if int64(len(header)) < encryptionHeaderSize || string(header[:len(encryptionMagic)]) != string(encryptionMagic) {
+		return nil, fmt.Errorf("object isn't in a known encryption format")
+	}
+	return header[len(encryptionMagic):encryptionHeaderSize], nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		// Read the next chunk, which is final if nothing follows it
+		chunk := make([]byte, encryptionChunkSize+encryptionTagSize)
+		n, err := io.ReadFull(d.src, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return 0, err
+		}
+		if err == nil {
+			_, err = d.src.Peek(1)
+		}
+		d.done = err != nil
+
+		d.buf, err = d.aead.Open(nil, chunkNonce(d.index, d.done), chunk[:n], nil)
+		if err != nil {
+			return 0, ErrDecryption
+		}
+		d.index++
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// isEncrypted reports whether an object's user metadata marks it as encrypted client-side.
+func isEncrypted(metadata map[string]string) bool {
+	return metadata[encryptionMetadataKey] != ""
+}
+
+// uploadHash returns a function creating the hash of uploaded data recorded in objects' metadata, and
+// the metadata key it's recorded under: an HMAC of the plaintext if the client encrypts objects, or
+// an MD5 hash otherwise.
+func (c *R2Client) uploadHash() (func() hash.Hash, string) {
+	if c.encryptionKey != nil {
+		return plaintextHMAC(c.encryptionKey), plaintextHMACKey
+	}
+	return md5.New, plaintextMD5Key
+}
+
+// encryptPut prepares an upload for client-side encryption, if the client has an encryption key.
+// The object is marked as encrypted in the metadata of opts, along with the plaintext's size and
+// HMAC if the reader is seekable, and a reader of the ciphertext is returned. The caller's metadata
+// map isn't modified.
+func (c *R2Client) encryptPut(r io.Reader, opts *PutOptions) (io.Reader, error) {
+	if c.encryptionKey == nil {
+		return r, nil
+	}
+
+	metadata := map[string]string{encryptionMetadataKey: encryptionScheme}
+	for key, value := range opts.Metadata {
+		metadata[key] = value
+	}
+
+	// Hash seekable plaintext, then rewind it, unless the data was compressed and its hash recorded
+	if size := readerSize(r); size >= 0 && opts.Metadata[plaintextSizeKey] == "" {
+		seeker := r.(io.Seeker)
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		newHash, hashKey := c.uploadHash()
+		hash := newHash()
+		if _, err := io.Copy(hash, r); err != nil {
+			return nil, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		metadata[plaintextSizeKey] = strconv.FormatInt(size, 10)
+		metadata[hashKey] = hex.EncodeToString(hash.Sum(nil))
+	}
+	opts.Metadata = metadata
+
+	return newEncryptReader(r, c.encryptionKey)
+}
+
+// decryptGet replaces the body of a fetched object with its plaintext, if the object is encrypted
+// client-side, adjusting its content length to the plaintext's size. Encrypted objects can only be
+// read whole, and need the client to have an encryption key.
+func (c *R2Client) decryptGet(obj *s3.GetObjectOutput, uri string, ranged bool) error {
+	if !isEncrypted(obj.Metadata) {
+		return nil
+	}
+	if c.encryptionKey == nil {
+		return fmt.Errorf("%s is encrypted client-side; set encryption_key_file in the profile or pass --encryption-key-file", uri)
+	}
+	if ranged {
+		return fmt.Errorf("%s is encrypted client-side, so byte ranges of it can't be read", uri)
+	}
+
+	body, err := newDecryptReader(obj.Body, c.encryptionKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", uri, err)
+	}
+	obj.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, obj.Body}
+	if obj.ContentLength != nil {
+		size := plaintextSize(*obj.ContentLength)
+		obj.ContentLength = &size
+	}
+	return nil
+}
+
+// plaintextSize returns the plaintext size of an encrypted object of the given size.
+func plaintextSize(size int64) int64 {
+	chunks := (size - encryptionHeaderSize + encryptionChunkSize + encryptionTagSize - 1) / (encryptionChunkSize + encryptionTagSize)
+	return size - encryptionHeaderSize - chunks*encryptionTagSize
+}
+
+// keepTransformMetadata returns metadata replacing that of an object, with the keys marking the
+// object as encrypted client-side and recording the data uploaded to it carried over from its
+// current metadata, so copies replacing the metadata of encrypted or compressed objects can still be
+// decrypted and compared with local files. The replacement map isn't modified.
+func keepTransformMetadata(current, replacement map[string]string) map[string]string {
+	if !isEncrypted(current) && current[plaintextSizeKey] == "" {
+		return replacement
+	}
+	metadata := make(map[string]string)
+	for key, value := range replacement {
+		metadata[key] = value
+	}
+	for _, key := range []string{encryptionMetadataKey, compressionMetadataKey, plaintextSizeKey, plaintextMD5Key, plaintextHMACKey} {
+		if value, ok := current[key]; ok {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
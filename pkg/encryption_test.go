@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testEncryptionKey is the key objects are encrypted with in tests.
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, encryptionKeySize)
+
+// testPlaintext returns size bytes of plaintext that differ between chunks.
+func testPlaintext(size int) []byte {
+	plaintext := make([]byte, size)
+	for i := range plaintext {
+		plaintext[i] = byte(i * 7)
+	}
+	return plaintext
+}
+
+// encrypt returns the ciphertext of plaintext, encrypted with key and the given salt.
+func encrypt(t *testing.T, plaintext, key, salt []byte) []byte {
+	t.Helper()
+	r, err := newEncryptReaderWithSalt(bytes.NewReader(plaintext), key, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ciphertext
+}
+
+// decrypt returns the plaintext of ciphertext decrypted with key, or the error decrypting it.
+func decrypt(ciphertext, key []byte) ([]byte, error) {
+	r, err := newDecryptReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 5869, test case 1, whose first 32 bytes of output are a single HKDF-SHA256 block
+	key, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	want := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if got := hex.EncodeToString(deriveKey(key, salt, string(info))); got != want {
+		t.Errorf("deriveKey = %s, want %s", got, want)
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	sizes := map[string]int{
+		"empty":              0,
+		"one byte":           1,
+		"exactly one chunk":  encryptionChunkSize,
+		"one chunk and more": encryptionChunkSize + 1,
+		"several chunks":     3*encryptionChunkSize + 5,
+	}
+	for name, size := range sizes {
+		plaintext := testPlaintext(size)
+		readers := map[string]func() io.Reader{
+			"seekable":     func() io.Reader { return bytes.NewReader(plaintext) },
+			"non-seekable": func() io.Reader { return struct{ io.Reader }{bytes.NewReader(plaintext)} },
+		}
+		for kind, reader := range readers {
+			t.Run(name+", "+kind, func(t *testing.T) {
+				r, err := newEncryptReader(reader(), testEncryptionKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ciphertext, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := int64(len(ciphertext)), encryptedSize(int64(size)); got != want {
+					t.Errorf("ciphertext is %d bytes, want %d", got, want)
+				}
+				if got := plaintextSize(int64(len(ciphertext))); got != int64(size) {
+					t.Errorf("plaintextSize = %d, want %d", got, size)
+				}
+
+				decrypted, err := decrypt(ciphertext, testEncryptionKey)
+				if err != nil {
+					t.Fatalf("decrypt: %v", err)
+				}
+				if !bytes.Equal(decrypted, plaintext) {
+					t.Errorf("decrypted %d bytes differing from the plaintext", len(decrypted))
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptWithSalt(t *testing.T) {
+	plaintext := testPlaintext(encryptionChunkSize + 1)
+	salt := bytes.Repeat([]byte{1}, encryptionSaltSize)
+	otherSalt := bytes.Repeat([]byte{2}, encryptionSaltSize)
+
+	// The same salt reproduces the same ciphertext, so stored objects can be checked
+	first, second := encrypt(t, plaintext, testEncryptionKey, salt), encrypt(t, plaintext, testEncryptionKey, salt)
+	if !bytes.Equal(first, second) {
+		t.Error("encrypting with the same salt produced different ciphertexts")
+	}
+	if got, err := encryptionSalt(first[:encryptionHeaderSize]); err != nil || !bytes.Equal(got, salt) {
+		t.Errorf("encryptionSalt = %x, %v, want %x", got, err, salt)
+	}
+
+	// Another salt gives another key, so the chunks differ too
+	other := encrypt(t, plaintext, testEncryptionKey, otherSalt)
+	if bytes.Equal(first[encryptionHeaderSize:], other[encryptionHeaderSize:]) {
+		t.Error("encrypting with different salts produced the same chunks")
+	}
+}
+
+func TestEncryptReadSeeker(t *testing.T) {
+	plaintext := testPlaintext(2*encryptionChunkSize + 10)
+	salt := bytes.Repeat([]byte{1}, encryptionSaltSize)
+	want := encrypt(t, plaintext, testEncryptionKey, salt)
+
+	r, err := newEncryptReaderWithSalt(bytes.NewReader(plaintext), testEncryptionKey, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("encrypting a seekable reader didn't return a seekable reader")
+	}
+
+	// Seeking to the end gives the ciphertext's size, as the SDK does to find the body's length
+	if end, err := seeker.Seek(0, io.SeekEnd); err != nil || end != int64(len(want)) {
+		t.Fatalf("Seek(0, io.SeekEnd) = %d, %v, want %d", end, err, len(want))
+	}
+
+	// Read part of the ciphertext, then rewind and read it all, as when a request is retried
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(seeker, make([]byte, encryptionChunkSize)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("ciphertext read after rewinding differs")
+	}
+
+	// Reading from the middle of a chunk re-encrypts it
+	offset := encryptionHeaderSize + encryptionChunkSize + encryptionTagSize + 100
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(seeker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want[offset:]) {
+		t.Error("ciphertext read after seeking into a chunk differs")
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	plaintext := testPlaintext(2*encryptionChunkSize + 10)
+	salt := bytes.Repeat([]byte{1}, encryptionSaltSize)
+	ciphertext := encrypt(t, plaintext, testEncryptionKey, salt)
+	firstChunkEnd := encryptionHeaderSize + encryptionChunkSize + encryptionTagSize
+
+	tampered := bytes.Clone(ciphertext)
+	tampered[firstChunkEnd+1] ^= 1
+	reordered := bytes.Clone(ciphertext[:encryptionHeaderSize])
+	reordered = append(reordered, ciphertext[firstChunkEnd:2*firstChunkEnd-encryptionHeaderSize]...)
+	reordered = append(reordered, ciphertext[encryptionHeaderSize:firstChunkEnd]...)
+	reordered = append(reordered, ciphertext[2*firstChunkEnd-encryptionHeaderSize:]...)
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+		key        []byte
+	}{
+		{"wrong key", ciphertext, bytes.Repeat([]byte{0x43}, encryptionKeySize)},
+		{"truncated at a chunk boundary", ciphertext[:firstChunkEnd], testEncryptionKey},
+		{"truncated after the header", ciphertext[:encryptionHeaderSize], testEncryptionKey},
+		{"truncated header", ciphertext[:encryptionHeaderSize-1], testEncryptionKey},
+		{"truncated within a chunk", ciphertext[:len(ciphertext)-1], testEncryptionKey},
+		{"tampered chunk", tampered, testEncryptionKey},
+		{"reordered chunks", reordered, testEncryptionKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(tt.ciphertext, tt.key); !errors.Is(err, ErrDecryption) {
+				t.Errorf("decrypt error = %v, want ErrDecryption", err)
+			}
+		})
+	}
+
+	// Objects in another format aren't mistaken for corrupted ones
+	other := bytes.Clone(ciphertext)
+	other[len(encryptionMagic)-1] = 1
+	if _, err := decrypt(other, testEncryptionKey); err == nil || errors.Is(err, ErrDecryption) {
+		t.Errorf("decrypt error = %v, want an unknown format error", err)
+	}
+}
+
+func TestPlaintextHMAC(t *testing.T) {
+	// HMACs depend on the key, unlike a plain hash of the contents
+	sum := func(key []byte) []byte {
+		h := plaintextHMAC(key)()
+		h.Write([]byte("hello"))
+		return h.Sum(nil)
+	}
+	if bytes.Equal(sum(testEncryptionKey), sum(bytes.Repeat([]byte{0x43}, encryptionKeySize))) {
+		t.Error("HMACs under different keys are equal")
+	}
+	if !bytes.Equal(sum(testEncryptionKey), sum(testEncryptionKey)) {
+		t.Error("HMACs under the same key differ")
+	}
+}
@@ -0,0 +1,144 @@
+// Object search
+
+package pkg
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// FindOptions holds the predicates objects must match to be found by Find. Empty fields match any
+// object.
+//
+// Name is a glob (as in path.Match) matched against the last path element of each key, e.g.
+// "*.parquet". LargerThan and SmallerThan bound objects' sizes in bytes, exclusively.
+// ModifiedBefore and ModifiedAfter bound their last modified times, exclusively. StorageClass only
+// matches objects in the given storage class.
+//
+// Metadata maps user metadata keys to globs their values must match; an empty glob only requires the
+// key to be present. Metadata isn't included in object listings, so matching it costs a HeadObject
+// call for every object matching the other predicates.
+type FindOptions struct {
+	Name           string
+	LargerThan     *int64
+	SmallerThan    *int64
+	ModifiedBefore time.Time
+	ModifiedAfter  time.Time
+	StorageClass   types.StorageClass
+	Metadata       map[string]string
+}
+
+// Validate checks that the globs in a set of find options are well-formed.
+func (o FindOptions) Validate() error {
+	if _, err := path.Match(o.Name, ""); err != nil {
+		return fmt.Errorf("invalid name pattern %q: %w", o.Name, err)
+	}
+	for key, pattern := range o.Metadata {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for metadata key %s: %w", pattern, key, err)
+		}
+	}
+	return nil
+}
+
+// ParseSizeBound parses a size bound as taken by find's --size flag into the LargerThan and
+// SmallerThan bounds of FindOptions: "+N" matches objects larger than N, "-N" objects smaller than
+// N, and "N" objects of exactly N bytes. N may have a unit, as in ParseByteSize, e.g. "+1G".
+func ParseSizeBound(bound string) (largerThan, smallerThan *int64, err error) {
+	sign, number := "", bound
+	if strings.HasPrefix(bound, "+") || strings.HasPrefix(bound, "-") {
+		sign, number = bound[:1], bound[1:]
+	}
+	n, err := ParseByteSize(number)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch sign {
+	case "+":
+		return aws.Int64(n), nil, nil
+	case "-":
+		return nil, aws.Int64(n), nil
+	default:
+		// Both bounds are exclusive, so an exact size lies between its neighbours
+		return aws.Int64(n - 1), aws.Int64(n + 1), nil
+	}
+}
+
+// matchesListing reports whether an object matches the predicates that can be checked from its
+// listing, i.e. all but Metadata.
+func (o FindOptions) matchesListing(object types.Object) bool {
+	key := aws.ToString(object.Key)
+	size := aws.ToInt64(object.Size)
+	modified := aws.ToTime(object.LastModified)
+
+	if o.Name != "" {
+		if match, _ := path.Match(o.Name, path.Base(key)); !match {
+			return false
+		}
+	}
+	if o.LargerThan != nil && size <= *o.LargerThan {
+		return false
+	}
+	if o.SmallerThan != nil && size >= *o.SmallerThan {
+		return false
+	}
+	if !o.ModifiedBefore.IsZero() && !modified.Before(o.ModifiedBefore) {
+		return false
+	}
+	if !o.ModifiedAfter.IsZero() && !modified.After(o.ModifiedAfter) {
+		return false
+	}
+	if o.StorageClass != "" && objectStorageClass(object) != o.StorageClass {
+		return false
+	}
+	return true
+}
+
+// matchesMetadata reports whether an object's user metadata matches the Metadata predicates. R2
+// returns metadata keys in lowercase, so keys are compared irrespective of case.
+func (o FindOptions) matchesMetadata(metadata map[string]string) bool {
+	for key, pattern := range o.Metadata {
+		value, ok := metadata[strings.ToLower(key)]
+		if !ok {
+			return false
+		}
+		if match, _ := path.Match(pattern, value); pattern != "" && !match {
+			return false
+		}
+	}
+	return true
+}
+
+// Find calls fn for each object with the specified prefix that matches opts, in key order. Objects
+// are walked a page at a time as with WalkObjectsWithPrefix, so fn may act on each object (e.g.
+// delete it) as it is found. If fn returns an error, the search stops and the error is returned,
+// unless it is ErrStopWalk, in which case the search stops without error.
+func (b *R2Bucket) Find(prefix string, opts FindOptions, fn func(types.Object) error) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	return b.WalkObjectsWithPrefix(prefix, func(object types.Object) error {
+		if !opts.matchesListing(object) {
+			return nil
+		}
+		if len(opts.Metadata) > 0 {
+			head, err := b.Stat(aws.ToString(object.Key))
+			if IsNotFound(err) {
+				// The object was deleted since it was listed
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !opts.matchesMetadata(head.Metadata) {
+				return nil
+			}
+		}
+		return fn(object)
+	})
+}
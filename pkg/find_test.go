@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestParseSizeBound(t *testing.T) {
+	tests := []struct {
+		bound       string
+		largerThan  *int64
+		smallerThan *int64
+		wantErr     bool
+	}{
+		{bound: "+1G", largerThan: aws.Int64(1 << 30)},
+		{bound: "-10M", smallerThan: aws.Int64(10 << 20)},
+		{bound: "512", largerThan: aws.Int64(511), smallerThan: aws.Int64(513)},
+		{bound: "0", largerThan: aws.Int64(-1), smallerThan: aws.Int64(1)},
+		{bound: "", wantErr: true},
+		{bound: "+", wantErr: true},
+		{bound: "+-5", wantErr: true},
+		{bound: "--5", wantErr: true},
+		{bound: "+10PB", wantErr: true},
+	}
+	for _, tt := range tests {
+		largerThan, smallerThan, err := ParseSizeBound(tt.bound)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSizeBound(%q) succeeded, want an error", tt.bound)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSizeBound(%q): %v", tt.bound, err)
+			continue
+		}
+		if !equalBound(largerThan, tt.largerThan) || !equalBound(smallerThan, tt.smallerThan) {
+			t.Errorf("ParseSizeBound(%q) = %v, %v, want %v, %v", tt.bound,
+				formatBound(largerThan), formatBound(smallerThan), formatBound(tt.largerThan), formatBound(tt.smallerThan))
+		}
+	}
+}
+
+// equalBound reports whether two optional size bounds are equal.
+func equalBound(a, b *int64) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+// formatBound formats an optional size bound for test failures.
+func formatBound(bound *int64) any {
+	if bound == nil {
+		return "none"
+	}
+	return *bound
+}
+
+func TestFindMatchesListing(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	object := func(key string, size int64, modified time.Time, storageClass types.ObjectStorageClass) types.Object {
+		return types.Object{Key: aws.String(key), Size: aws.Int64(size), LastModified: aws.Time(modified), StorageClass: storageClass}
+	}
+	bounds := func(bound string) FindOptions {
+		largerThan, smallerThan, err := ParseSizeBound(bound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FindOptions{LargerThan: largerThan, SmallerThan: smallerThan}
+	}
+
+	tests := []struct {
+		name   string
+		opts   FindOptions
+		object types.Object
+		want   bool
+	}{
+		{"no predicates", FindOptions{}, object("a/b.txt", 10, now, ""), true},
+		{"name matches the last element", FindOptions{Name: "*.parquet"}, object("data/2024/x.parquet", 10, now, ""), true},
+		{"name doesn't match directories", FindOptions{Name: "data*"}, object("data/x.parquet", 10, now, ""), false},
+		{"exact size", bounds("100"), object("a", 100, now, ""), true},
+		{"exact size, one byte less", bounds("100"), object("a", 99, now, ""), false},
+		{"exact size, one byte more", bounds("100"), object("a", 101, now, ""), false},
+		{"empty object of exactly 0 bytes", bounds("0"), object("a", 0, now, ""), true},
+		{"larger than, exclusive", bounds("+1K"), object("a", 1024, now, ""), false},
+		{"larger than", bounds("+1K"), object("a", 1025, now, ""), true},
+		{"smaller than, exclusive", bounds("-1K"), object("a", 1024, now, ""), false},
+		{"smaller than", bounds("-1K"), object("a", 1023, now, ""), true},
+		{"modified before", FindOptions{ModifiedBefore: now}, object("a", 1, now.Add(-time.Second), ""), true},
+		{"modified before, exclusive", FindOptions{ModifiedBefore: now}, object("a", 1, now, ""), false},
+		{"modified after", FindOptions{ModifiedAfter: now}, object("a", 1, now.Add(time.Second), ""), true},
+		{"modified after, exclusive", FindOptions{ModifiedAfter: now}, object("a", 1, now, ""), false},
+		{"omitted storage class is Standard", FindOptions{StorageClass: types.StorageClassStandard}, object("a", 1, now, ""), true},
+		{"other storage class", FindOptions{StorageClass: types.StorageClassStandard}, object("a", 1, now, "STANDARD_IA"), false},
+		{"all predicates", FindOptions{Name: "*.log", LargerThan: aws.Int64(5), ModifiedBefore: now}, object("logs/app.log", 6, now.Add(-time.Hour), ""), true},
+		{"all but one predicate", FindOptions{Name: "*.log", LargerThan: aws.Int64(5), ModifiedBefore: now}, object("logs/app.log", 5, now.Add(-time.Hour), ""), false},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.matchesListing(tt.object); got != tt.want {
+			t.Errorf("%s: matchesListing = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindMatchesMetadata(t *testing.T) {
+	metadata := map[string]string{"job": "nightly-42", "owner": ""}
+	tests := []struct {
+		predicates map[string]string
+		want       bool
+	}{
+		{nil, true},
+		{map[string]string{"job": "nightly-*"}, true},
+		{map[string]string{"Job": "nightly-*"}, true},
+		{map[string]string{"job": "hourly-*"}, false},
+		{map[string]string{"job": ""}, true},
+		{map[string]string{"owner": ""}, true},
+		{map[string]string{"team": ""}, false},
+	}
+	for _, tt := range tests {
+		if got := (FindOptions{Metadata: tt.predicates}).matchesMetadata(metadata); got != tt.want {
+			t.Errorf("matchesMetadata(%v) = %v, want %v", tt.predicates, got, tt.want)
+		}
+	}
+}
@@ -1,15 +1,29 @@
 package pkg
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"mime"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyHTTP "github.com/aws/smithy-go/transport/http"
+	"gopkg.in/yaml.v3"
 )
 
 // Contains checks if a string is in a slice of strings.
@@ -39,6 +53,11 @@ func fileSizeFmt(b int64) []string {
 	}
 }
 
+// FormatSize formats a size in bytes as a human-readable string, e.g. "1.23 MB".
+func FormatSize(b int64) string {
+	return strings.Join(fileSizeFmt(b), " ")
+}
+
 // fileExists checks if a file exists.
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -107,6 +126,11 @@ func ParseR2URISafe(uri string) R2URI {
 
 // md5sum returns the MD5 hash of a file given its path.
 func md5sum(path string) string {
+	return hashsum(path, md5.New)
+}
+
+// hashsum returns the hex-encoded hash of a file given its path, computed with the given hash.
+func hashsum(path string, newHash func() hash.Hash) string {
 	// Get file
 	file, err := os.Open(path)
 	if err != nil {
@@ -115,11 +139,257 @@ func md5sum(path string) string {
 	defer file.Close()
 
 	// Get file hash
-	hash := md5.New()
+	hash := newHash()
 	if _, err := io.Copy(hash, file); err != nil {
 		log.Fatal(err)
 	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// contentTypeOf returns the content type of an object, detected from the extension of its key or,
+// if the extension is unknown, by sniffing its contents. Only the first 512 bytes of data are used.
+func contentTypeOf(key string, data []byte) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
+
+// detectContentType detects the content type of an object being read from r. As sniffing consumes
+// the start of the stream, a reader positioned at the start of the object is returned alongside the
+// content type, and should be used in place of r. Seekable readers are rewound rather than wrapped,
+// so they remain seekable.
+func detectContentType(r io.Reader, key string) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType, r, nil
+	}
+
+	// Read up to 512 bytes, the most http.DetectContentType considers
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(int64(-n), io.SeekCurrent); err == nil {
+			return http.DetectContentType(head), r, nil
+		}
+	}
+	return http.DetectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// PreconditionFailedError is returned by conditional requests whose If-Match or If-None-Match
+// precondition isn't met: for writes, because the object already exists or has changed since it
+// was read; for reads, because the object has or hasn't changed. Err holds the underlying error.
+type PreconditionFailedError struct {
+	URI string
+	Err error
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("precondition failed for %s: %v", e.URI, e.Err)
+}
+
+func (e *PreconditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// IsPreconditionFailed checks if an error returned by an R2 operation is a PreconditionFailedError.
+func IsPreconditionFailed(err error) bool {
+	var preconditionFailed *PreconditionFailedError
+	return errors.As(err, &preconditionFailed)
+}
+
+// conditionalError converts an error returned by a conditional request into a
+// PreconditionFailedError if its precondition wasn't met, returning other errors unchanged. Besides
+// 412 Precondition Failed, a 304 Not Modified response to a read and a 409 conflict between
+// concurrent conditional writes both mean the precondition didn't hold.
+func conditionalError(uri string, err error) error {
+	if err == nil {
+		return nil
+	}
 
-	hashBytes := hash.Sum(nil)[:16]
-	return hex.EncodeToString(hashBytes)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "NotModified", "ConditionalRequestConflict":
+			return &PreconditionFailedError{URI: uri, Err: err}
+		}
+	}
+	var respErr *smithyHTTP.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusPreconditionFailed, http.StatusNotModified:
+			return &PreconditionFailedError{URI: uri, Err: err}
+		}
+	}
+	return err
+}
+
+// isAccessDenied checks if an error returned by an R2 operation means the credentials aren't allowed
+// to make the request.
+func isAccessDenied(err error) bool {
+	var respErr *smithyHTTP.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFound checks if an error returned by an R2 operation indicates that the requested object or
+// bucket does not exist.
+func IsNotFound(err error) bool {
+	var notFound *types.NotFound
+	var noSuchKey *types.NoSuchKey
+	var noSuchBucket *types.NoSuchBucket
+	if errors.As(err, &notFound) || errors.As(err, &noSuchKey) || errors.As(err, &noSuchBucket) {
+		return true
+	}
+
+	// HeadObject responses have no body, so missing objects may only be identifiable by error code
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey", "NoSuchBucket":
+			return true
+		}
+	}
+	return false
+}
+
+// ByteRange formats an HTTP byte range for GetOptions.Range. A non-negative offset with a positive
+// length selects length bytes starting at offset, and a length of zero or less selects everything
+// from offset onwards. A negative offset selects the last -offset bytes, ignoring length.
+func ByteRange(offset, length int64) string {
+	if offset < 0 {
+		return fmt.Sprintf("bytes=%d", offset)
+	}
+	if length <= 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// ParseStorageClass parses the name of an R2 storage class. R2 offers the Standard and Infrequent
+// Access storage classes, which may be given by their R2 names ("Standard", "InfrequentAccess") or
+// their S3 API names ("STANDARD", "STANDARD_IA"), irrespective of case.
+func ParseStorageClass(name string) (types.StorageClass, error) {
+	switch strings.ToUpper(strings.ReplaceAll(name, "-", "_")) {
+	case "STANDARD":
+		return types.StorageClassStandard, nil
+	case "STANDARD_IA", "INFREQUENTACCESS", "INFREQUENT_ACCESS":
+		return types.StorageClassStandardIa, nil
+	default:
+		return "", fmt.Errorf("unknown storage class %q: must be Standard or InfrequentAccess", name)
+	}
+}
+
+// objectStorageClass returns the storage class of a listed object. R2 may omit the storage class of
+// objects in the default class, so an empty class is reported as Standard.
+func objectStorageClass(object types.Object) types.StorageClass {
+	if object.StorageClass == "" {
+		return types.StorageClassStandard
+	}
+	return types.StorageClass(object.StorageClass)
+}
+
+// byteSizeRe matches a human-readable size, capturing its number and unit.
+var byteSizeRe = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([a-zA-Z]*)\s*$`)
+
+// ParseByteSize parses a human-readable size such as "512", "64KB", "1.5G" or "2GiB" into a number
+// of bytes. Units are binary, matching FormatSize, so 1KB is 1024 bytes.
+func ParseByteSize(size string) (int64, error) {
+	match := byteSizeRe.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+
+	var multiplier float64
+	unit := strings.ToUpper(match[2])
+	if trimmed := strings.TrimSuffix(unit, "IB"); trimmed != unit {
+		unit = trimmed
+	} else {
+		unit = strings.TrimSuffix(unit, "B")
+	}
+
+	switch unit {
+	case "":
+		multiplier = 1
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	default:
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", size, match[2])
+	}
+
+	return int64(number * multiplier), nil
+}
+
+// ParseBandwidth parses a human-readable bandwidth such as "50MB/s" or "512K" into a number of bytes
+// per second. The "/s" suffix is optional.
+func ParseBandwidth(bandwidth string) (int64, error) {
+	return ParseByteSize(strings.TrimSuffix(strings.TrimSpace(bandwidth), "/s"))
+}
+
+// dayDurationRe matches a duration in days or weeks, which time.ParseDuration doesn't support.
+var dayDurationRe = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// ParseAge parses an age into the point in time it refers to. Ages may be durations before now, such
+// as "90m", "12h", "30d" or "2w", or absolute dates and times, such as "2024-06-01" (midnight UTC) or
+// "2024-06-01T12:00:00Z".
+func ParseAge(age string) (time.Time, error) {
+	if match := dayDurationRe.FindStringSubmatch(age); match != nil {
+		days, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			days *= 7
+		}
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+	if duration, err := time.ParseDuration(age); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, age); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid age %q: must be a duration (e.g. 12h, 30d, 2w) or a date (e.g. 2024-06-01)", age)
+}
+
+// decodeRuleFile decodes a bucket configuration rule file into v. Files starting with "{" are
+// decoded as JSON, and any other file as YAML. Unknown fields are rejected in both formats, so
+// misspelled settings aren't silently ignored, and empty files are rejected, so a truncated file
+// isn't mistaken for one removing every rule.
+func decodeRuleFile(data []byte, v any) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(v); err != nil {
+			return fmt.Errorf("invalid JSON rule file: %w", err)
+		}
+		return nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err == io.EOF {
+		return errors.New("the rule file is empty")
+	} else if err != nil {
+		return fmt.Errorf("invalid YAML rule file: %w", err)
+	}
+	return nil
 }
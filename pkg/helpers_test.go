@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestByteRange(t *testing.T) {
+	tests := []struct {
+		offset int64
+		length int64
+		want   string
+	}{
+		{0, 1024, "bytes=0-1023"},
+		{1024, 1, "bytes=1024-1024"},
+		{1024, 0, "bytes=1024-"},
+		{1024, -1, "bytes=1024-"},
+		{0, 0, "bytes=0-"},
+		{-4096, 0, "bytes=-4096"},
+		// Lengths are ignored for suffix ranges
+		{-4096, 10, "bytes=-4096"},
+	}
+	for _, tt := range tests {
+		if got := ByteRange(tt.offset, tt.length); got != tt.want {
+			t.Errorf("ByteRange(%d, %d) = %q, want %q", tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "0", want: 0},
+		{size: "512", want: 512},
+		{size: "512B", want: 512},
+		{size: "64KB", want: 64 << 10},
+		{size: "64k", want: 64 << 10},
+		{size: "1.5G", want: 3 << 29},
+		{size: "2GiB", want: 2 << 30},
+		{size: "1 TB", want: 1 << 40},
+		{size: " 8mib ", want: 8 << 20},
+		{size: "", wantErr: true},
+		{size: "MB", wantErr: true},
+		{size: "-1KB", wantErr: true},
+		{size: "10PB", wantErr: true},
+		{size: "1.2.3K", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want an error", tt.size, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		bandwidth string
+		want      int64
+		wantErr   bool
+	}{
+		{bandwidth: "50MB/s", want: 50 << 20},
+		{bandwidth: "512K", want: 512 << 10},
+		{bandwidth: " 1GiB/s ", want: 1 << 30},
+		{bandwidth: "0", want: 0},
+		{bandwidth: "/s", wantErr: true},
+		{bandwidth: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseBandwidth(tt.bandwidth)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseBandwidth(%q) = %d, want an error", tt.bandwidth, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBandwidth(%q) = %d, %v, want %d", tt.bandwidth, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		age     string
+		want    time.Time
+		wantErr bool
+	}{
+		{age: "90m", want: now.Add(-90 * time.Minute)},
+		{age: "12h", want: now.Add(-12 * time.Hour)},
+		{age: "30d", want: now.AddDate(0, 0, -30)},
+		{age: "2w", want: now.AddDate(0, 0, -14)},
+		{age: "2024-06-01", want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{age: "2024-06-01T12:00:00Z", want: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{age: "", wantErr: true},
+		{age: "30 days", wantErr: true},
+		{age: "1y", wantErr: true},
+		{age: "2024-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.age)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAge(%q) = %v, want an error", tt.age, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAge(%q): %v", tt.age, err)
+			continue
+		}
+		// Relative ages are computed from the current time, so allow for the time the test takes
+		if diff := got.Sub(tt.want); diff < -time.Minute || diff > time.Minute {
+			t.Errorf("ParseAge(%q) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
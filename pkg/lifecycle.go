@@ -0,0 +1,278 @@
+// Bucket lifecycle rules
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// maxLifecycleRules is the largest number of lifecycle rules a bucket may have.
+const maxLifecycleRules = 1000
+
+// lifecycleDateFormat is the format of lifecycle rule dates. Rules take effect at midnight UTC.
+const lifecycleDateFormat = "2006-01-02"
+
+// LifecycleConfig is a bucket's lifecycle configuration, as read from and written to rule files.
+type LifecycleConfig struct {
+	Rules []LifecycleRule `json:"rules" yaml:"rules"`
+}
+
+// LifecycleRule is a lifecycle rule applying to the objects whose keys start with Prefix, or to all
+// objects if Prefix is empty. Each rule has at least one action:
+//
+//   - ExpireAfterDays deletes objects the given number of days after they were created, and
+//     ExpireOn deletes them on the given date (YYYY-MM-DD)
+//   - TransitionAfterDays moves objects to the Infrequent Access storage class the given number of
+//     days after they were created
+//   - AbortIncompleteUploadsAfterDays aborts incomplete multipart uploads the given number of days
+//     after they were initiated
+//
+// Rules are enabled unless Enabled is set to false.
+type LifecycleRule struct {
+	ID                              string `json:"id" yaml:"id"`
+	Prefix                          string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Enabled                         *bool  `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	ExpireAfterDays                 int32  `json:"expireAfterDays,omitempty" yaml:"expireAfterDays,omitempty"`
+	ExpireOn                        string `json:"expireOn,omitempty" yaml:"expireOn,omitempty"`
+	TransitionAfterDays             int32  `json:"transitionAfterDays,omitempty" yaml:"transitionAfterDays,omitempty"`
+	AbortIncompleteUploadsAfterDays int32  `json:"abortIncompleteUploadsAfterDays,omitempty" yaml:"abortIncompleteUploadsAfterDays,omitempty"`
+}
+
+// enabled reports whether the rule is enabled.
+func (r LifecycleRule) enabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// ParseLifecycleConfig parses a lifecycle configuration from a JSON or YAML rule file and validates
+// it. Unknown fields are rejected, so misspelled actions aren't silently ignored. Files without any
+// rules are rejected too; RemoveLifecycle removes a bucket's rules.
+func ParseLifecycleConfig(data []byte) (LifecycleConfig, error) {
+	var config LifecycleConfig
+	if err := decodeRuleFile(data, &config); err != nil {
+		return config, err
+	}
+	if len(config.Rules) == 0 {
+		return config, errors.New("the rule file has no rules")
+	}
+	return config, config.Validate()
+}
+
+// Validate checks that a lifecycle configuration can be applied to a bucket, returning an error
+// describing every invalid rule.
+func (c LifecycleConfig) Validate() error {
+	if len(c.Rules) > maxLifecycleRules {
+		return fmt.Errorf("too many rules: a bucket may have at most %d", maxLifecycleRules)
+	}
+
+	var errs []error
+	ids := make(map[string]bool)
+	for i, rule := range c.Rules {
+		// Identify rules by ID where possible, or by their position otherwise
+		name := fmt.Sprintf("rule %d", i+1)
+		if rule.ID != "" {
+			name = fmt.Sprintf("rule %q", rule.ID)
+		}
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+
+		if rule.ID == "" {
+			invalid("id is required")
+		} else if len(rule.ID) > 255 {
+			invalid("id must be at most 255 characters")
+		} else if ids[rule.ID] {
+			invalid("id is used by another rule")
+		}
+		ids[rule.ID] = true
+
+		if rule.ExpireAfterDays == 0 && rule.ExpireOn == "" && rule.TransitionAfterDays == 0 && rule.AbortIncompleteUploadsAfterDays == 0 {
+			invalid("no actions: set expireAfterDays, expireOn, transitionAfterDays or abortIncompleteUploadsAfterDays")
+		}
+		if rule.ExpireAfterDays < 0 || rule.TransitionAfterDays < 0 || rule.AbortIncompleteUploadsAfterDays < 0 {
+			invalid("days must be positive")
+		}
+		if rule.ExpireAfterDays != 0 && rule.ExpireOn != "" {
+			invalid("expireAfterDays and expireOn can't both be set")
+		}
+		if rule.ExpireOn != "" {
+			if _, err := time.Parse(lifecycleDateFormat, rule.ExpireOn); err != nil {
+				invalid("expireOn %q must be a date in the form YYYY-MM-DD", rule.ExpireOn)
+			}
+		}
+		if rule.ExpireAfterDays > 0 && rule.TransitionAfterDays >= rule.ExpireAfterDays {
+			invalid("transitionAfterDays must be less than expireAfterDays, or objects expire before they transition")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// toS3 converts a lifecycle rule to its S3 API representation. The rule must be valid.
+func (r LifecycleRule) toS3() types.LifecycleRule {
+	rule := types.LifecycleRule{
+		ID:     aws.String(r.ID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)},
+	}
+	if !r.enabled() {
+		rule.Status = types.ExpirationStatusDisabled
+	}
+
+	if r.ExpireAfterDays > 0 {
+		rule.Expiration = &types.LifecycleExpiration{Days: aws.Int32(r.ExpireAfterDays)}
+	} else if r.ExpireOn != "" {
+		date, _ := time.Parse(lifecycleDateFormat, r.ExpireOn)
+		rule.Expiration = &types.LifecycleExpiration{Date: aws.Time(date)}
+	}
+	if r.TransitionAfterDays > 0 {
+		rule.Transitions = []types.Transition{{
+			Days:         aws.Int32(r.TransitionAfterDays),
+			StorageClass: types.TransitionStorageClassStandardIa,
+		}}
+	}
+	if r.AbortIncompleteUploadsAfterDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(r.AbortIncompleteUploadsAfterDays),
+		}
+	}
+
+	return rule
+}
+
+// lifecycleRuleFromS3 converts a lifecycle rule from its S3 API representation. Conditions and
+// actions R2 doesn't support are ignored.
+func lifecycleRuleFromS3(r types.LifecycleRule) LifecycleRule {
+	rule := LifecycleRule{ID: aws.ToString(r.ID), Prefix: aws.ToString(r.Prefix)}
+	if r.Filter != nil && r.Filter.Prefix != nil {
+		rule.Prefix = *r.Filter.Prefix
+	}
+	if r.Status != types.ExpirationStatusEnabled {
+		rule.Enabled = aws.Bool(false)
+	}
+
+	if r.Expiration != nil {
+		if r.Expiration.Days != nil {
+			rule.ExpireAfterDays = *r.Expiration.Days
+		} else if r.Expiration.Date != nil {
+			rule.ExpireOn = r.Expiration.Date.UTC().Format(lifecycleDateFormat)
+		}
+	}
+	for _, transition := range r.Transitions {
+		if transition.Days != nil {
+			rule.TransitionAfterDays = *transition.Days
+		}
+	}
+	if r.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteUploadsAfterDays = aws.ToInt32(r.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+	}
+
+	return rule
+}
+
+// GetLifecycle returns a bucket's lifecycle configuration. Buckets without lifecycle rules return an
+// empty configuration.
+func (b *R2Bucket) GetLifecycle() (LifecycleConfig, error) {
+	output, err := b.Client.GetBucketLifecycleConfiguration(context.TODO(), &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: &b.Name,
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return LifecycleConfig{}, nil
+	} else if err != nil {
+		return LifecycleConfig{}, err
+	}
+
+	var config LifecycleConfig
+	for _, rule := range output.Rules {
+		config.Rules = append(config.Rules, lifecycleRuleFromS3(rule))
+	}
+	return config, nil
+}
+
+// PutLifecycle validates a lifecycle configuration and applies it to a bucket, replacing its
+// existing rules.
+func (b *R2Bucket) PutLifecycle(config LifecycleConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if len(config.Rules) == 0 {
+		return b.RemoveLifecycle()
+	}
+
+	var rules []types.LifecycleRule
+	for _, rule := range config.Rules {
+		rules = append(rules, rule.toS3())
+	}
+	_, err := b.Client.PutBucketLifecycleConfiguration(context.TODO(), &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 &b.Name,
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	return err
+}
+
+// RemoveLifecycle removes all lifecycle rules from a bucket.
+func (b *R2Bucket) RemoveLifecycle() error {
+	_, err := b.Client.DeleteBucketLifecycle(context.TODO(), &s3.DeleteBucketLifecycleInput{
+		Bucket: &b.Name,
+	})
+	return err
+}
+
+// PrintLifecycle prints a human-readable description of a bucket's lifecycle rules.
+func (b *R2Bucket) PrintLifecycle() error {
+	config, err := b.GetLifecycle()
+	if err != nil {
+		return err
+	}
+	if len(config.Rules) == 0 {
+		fmt.Printf("r2://%s has no lifecycle rules\n", b.Name)
+		return nil
+	}
+
+	for i, rule := range config.Rules {
+		// Separate rules with a blank line
+		if i > 0 {
+			fmt.Println()
+		}
+
+		status := "enabled"
+		if !rule.enabled() {
+			status = "disabled"
+		}
+		fmt.Printf("%s (%s)\n", rule.ID, status)
+
+		if rule.Prefix == "" {
+			fmt.Println("  Applies to:  all objects")
+		} else {
+			fmt.Printf("  Applies to:  objects starting with %s\n", rule.Prefix)
+		}
+		if rule.TransitionAfterDays > 0 {
+			fmt.Printf("  Transition:  to InfrequentAccess %s after creation\n", days(rule.TransitionAfterDays))
+		}
+		if rule.ExpireAfterDays > 0 {
+			fmt.Printf("  Expire:      %s after creation\n", days(rule.ExpireAfterDays))
+		} else if rule.ExpireOn != "" {
+			fmt.Printf("  Expire:      on %s\n", rule.ExpireOn)
+		}
+		if rule.AbortIncompleteUploadsAfterDays > 0 {
+			fmt.Printf("  Abort:       incomplete multipart uploads %s after initiation\n", days(rule.AbortIncompleteUploadsAfterDays))
+		}
+	}
+	return nil
+}
+
+// days formats a number of days, e.g. "1 day" or "30 days".
+func days(n int32) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLifecycleConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []LifecycleRule
+		wantErr []string
+	}{
+		{
+			name: "valid rules",
+			rules: []LifecycleRule{
+				{ID: "logs", Prefix: "logs/", TransitionAfterDays: 30, ExpireAfterDays: 365},
+				{ID: "uploads", AbortIncompleteUploadsAfterDays: 7},
+				{ID: "campaign", ExpireOn: "2030-01-01"},
+			},
+		},
+		{name: "no rules"},
+		{
+			name:    "missing id",
+			rules:   []LifecycleRule{{ExpireAfterDays: 1}},
+			wantErr: []string{"rule 1: id is required"},
+		},
+		{
+			name:    "id too long",
+			rules:   []LifecycleRule{{ID: strings.Repeat("a", 256), ExpireAfterDays: 1}},
+			wantErr: []string{"at most 255 characters"},
+		},
+		{
+			name: "duplicate id",
+			rules: []LifecycleRule{
+				{ID: "logs", ExpireAfterDays: 1},
+				{ID: "logs", ExpireAfterDays: 2},
+			},
+			wantErr: []string{`rule "logs": id is used by another rule`},
+		},
+		{
+			name:    "no actions",
+			rules:   []LifecycleRule{{ID: "logs", Prefix: "logs/"}},
+			wantErr: []string{"no actions"},
+		},
+		{
+			name:    "negative days",
+			rules:   []LifecycleRule{{ID: "logs", ExpireAfterDays: -1}},
+			wantErr: []string{"days must be positive"},
+		},
+		{
+			name:    "both expiries",
+			rules:   []LifecycleRule{{ID: "logs", ExpireAfterDays: 1, ExpireOn: "2030-01-01"}},
+			wantErr: []string{"can't both be set"},
+		},
+		{
+			name:    "invalid date",
+			rules:   []LifecycleRule{{ID: "logs", ExpireOn: "01/01/2030"}},
+			wantErr: []string{"YYYY-MM-DD"},
+		},
+		{
+			name:    "transition after expiry",
+			rules:   []LifecycleRule{{ID: "logs", TransitionAfterDays: 30, ExpireAfterDays: 30}},
+			wantErr: []string{"transitionAfterDays must be less than expireAfterDays"},
+		},
+		{
+			name: "every invalid rule is reported",
+			rules: []LifecycleRule{
+				{ID: "a"},
+				{ID: "b", ExpireOn: "soon"},
+			},
+			wantErr: []string{`rule "a": no actions`, `rule "b": expireOn "soon"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := LifecycleConfig{Rules: tt.rules}.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate succeeded, want errors containing %q", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLifecycleConfigValidateTooManyRules(t *testing.T) {
+	rules := make([]LifecycleRule, maxLifecycleRules+1)
+	if err := (LifecycleConfig{Rules: rules}).Validate(); err == nil || !strings.Contains(err.Error(), "too many rules") {
+		t.Fatalf("Validate error = %v, want too many rules", err)
+	}
+}
+
+func TestParseLifecycleConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		rules   int
+		wantErr string
+	}{
+		{name: "YAML", data: "rules:\n  - id: logs\n    expireAfterDays: 30\n", rules: 1},
+		{name: "JSON", data: `{"rules": [{"id": "logs", "expireAfterDays": 30}]}`, rules: 1},
+		{name: "empty file", data: "", wantErr: "empty"},
+		{name: "no rules", data: "rules: []\n", wantErr: "no rules"},
+		{name: "unknown field", data: "rules:\n  - id: logs\n    expireAfter: 30\n", wantErr: "expireAfter"},
+		{name: "invalid rule", data: "rules:\n  - id: logs\n", wantErr: "no actions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseLifecycleConfig([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseLifecycleConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLifecycleConfig: %v", err)
+			}
+			if len(config.Rules) != tt.rules {
+				t.Errorf("got %d rules, want %d", len(config.Rules), tt.rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Distributed locking
+
+package pkg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	// leaseOwnerKey and leaseExpiresKey are the user metadata keys holding a lease's owner and
+	// expiry time, so leases can be inspected with a HeadObject call.
+	leaseOwnerKey   = "lease-owner"
+	leaseExpiresKey = "lease-expires"
+
+	// lockPollInterval is how often AcquireWait retries acquiring a held lock.
+	lockPollInterval = time.Second
+)
+
+// ErrLockLost is returned by Renew and Release when the lease was taken over by another owner,
+// either because it expired or because it was released.
+var ErrLockLost = errors.New("lock lost: the lease is no longer held by this owner")
+
+// LockHeldError is returned by Acquire when the lock is held by another owner whose lease hasn't
+// expired.
+type LockHeldError struct {
+	URI     string
+	Owner   string
+	Expires time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("lock %s is held by %s until %s", e.URI, e.Owner, e.Expires.Format(time.RFC3339))
+}
+
+// Lock is a distributed lock built on conditional writes. The lock is held by whoever owns the lease
+// object at its key: leases are created with If-None-Match, so only one owner can create one, and
+// renewed, taken over or released with If-Match, so an owner can only change the lease it last saw.
+// Leases record their owner and expiry time in both their body and user metadata. Expired leases
+// may be taken over by anyone, so owners must Renew their lease before it expires.
+//
+// A lock only takes over or releases an unexpired lease it wrote itself, identified by the lease's
+// ETag, so two processes using the same owner name still exclude each other. If Reentrant is set, an
+// unexpired lease recorded under the lock's owner is treated as held by it too, e.g. so a lease
+// acquired by one process can be released by another that was given the same owner.
+//
+// Expiry times are set using the clock of the host writing the lease, so hosts sharing a lock should
+// have reasonably synchronized clocks, and TTLs should comfortably exceed any clock skew.
+type Lock struct {
+	Bucket    *R2Bucket
+	Key       string
+	Owner     string
+	TTL       time.Duration
+	Reentrant bool
+
+	// etag is the ETag of the lease last written by this owner, if it holds the lock
+	etag string
+}
+
+// lease is the body of a lease object.
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewLockOwner returns an owner name unique to this process: the host name, process ID and a random
+// suffix, e.g. "web-1-4182-9f3c2a7e". Owners shared by several processes, such as the bare host name,
+// can't tell those processes' leases apart.
+func NewLockOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Lock returns a lock whose lease object is stored at the given key of the bucket. Leases taken by
+// the lock are held by owner for ttl at a time.
+func (b *R2Bucket) Lock(key, owner string, ttl time.Duration) *Lock {
+	return &Lock{Bucket: b, Key: key, Owner: owner, TTL: ttl}
+}
+
+// uri returns the R2 URI of the lock's lease object.
+func (l *Lock) uri() string {
+	return fmt.Sprintf("r2://%s/%s", l.Bucket.Name, l.Key)
+}
+
+// write writes a lease owned by this lock's owner, expiring after expires, under the given
+// precondition. On success, the lease's ETag is recorded so it can be renewed or released.
+//
+// Failed requests are retried, so if a write reached R2 but its response was lost, its retry fails
+// the precondition against the lease the first attempt wrote. A failed precondition is therefore
+// checked against the current lease: if it records this owner and the exact expiry time just
+// written, the write succeeded.
+func (l *Lock) write(expires time.Time, precondition PutOptions) error {
+	body, err := json.Marshal(lease{Owner: l.Owner, Expires: expires.UTC()})
+	if err != nil {
+		return err
+	}
+
+	expiresValue := expires.UTC().Format(time.RFC3339Nano)
+	precondition.ContentType = "application/json"
+	precondition.Metadata = map[string]string{
+		leaseOwnerKey:   l.Owner,
+		leaseExpiresKey: expiresValue,
+	}
+	output, err := l.Bucket.putObject(bytes.NewReader(body), l.Key, precondition)
+	if IsPreconditionFailed(err) {
+		head, headErr := l.Bucket.Stat(l.Key)
+		if headErr == nil && head.Metadata[leaseOwnerKey] == l.Owner && head.Metadata[leaseExpiresKey] == expiresValue {
+			l.etag = aws.ToString(head.ETag)
+			return nil
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	l.etag = aws.ToString(output.ETag)
+	return nil
+}
+
+// current returns the ETag, owner and expiry time of the existing lease. Leases without a valid
+// expiry time are treated as already expired.
+func (l *Lock) current() (etag, owner string, expires time.Time, err error) {
+	head, err := l.Bucket.Stat(l.Key)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	expires, _ = time.Parse(time.RFC3339Nano, head.Metadata[leaseExpiresKey])
+	return aws.ToString(head.ETag), head.Metadata[leaseOwnerKey], expires, nil
+}
+
+// Acquire takes the lock, failing with a *LockHeldError if another owner holds an unexpired lease.
+// If the existing lease has expired, was written by this lock, or belongs to this lock's owner and
+// the lock is Reentrant, it is taken over, but only if it is unchanged since it was read, so two
+// hosts can't both take over the same expired lease.
+func (l *Lock) Acquire() error {
+	for {
+		// Create the lease if there isn't one
+		err := l.write(time.Now().Add(l.TTL), PutOptions{IfNoneMatch: "*"})
+		if !IsPreconditionFailed(err) {
+			return err
+		}
+
+		// A lease exists, so check whether it can be taken over
+		etag, owner, expires, err := l.current()
+		if IsNotFound(err) {
+			// The lease was released in the meantime, so try creating it again
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !l.holds(etag, owner) && time.Now().Before(expires) {
+			return &LockHeldError{URI: l.uri(), Owner: owner, Expires: expires}
+		}
+
+		err = l.write(time.Now().Add(l.TTL), PutOptions{IfMatch: etag})
+		if IsPreconditionFailed(err) {
+			// Another host changed the lease first; check again whether it can be taken over
+			continue
+		}
+		return err
+	}
+}
+
+// holds reports whether a lease with the given ETag and owner is held by this lock: either it wrote
+// the lease itself, or the lease belongs to its owner and the lock is Reentrant.
+func (l *Lock) holds(etag, owner string) bool {
+	return (l.etag != "" && etag == l.etag) || (l.Reentrant && owner == l.Owner)
+}
+
+// AcquireWait takes the lock like Acquire, waiting up to timeout for another owner's lease to be
+// released or to expire. If the lock is still held once timeout has passed, the *LockHeldError from
+// the last attempt is returned.
+func (l *Lock) AcquireWait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := l.Acquire()
+		var held *LockHeldError
+		if !errors.As(err, &held) || time.Now().Add(lockPollInterval).After(deadline) {
+			return err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Renew extends the lease held by this lock by another TTL from now. If the lease was taken over by
+// another owner, ErrLockLost is returned and the lock must be considered lost.
+func (l *Lock) Renew() error {
+	if l.etag == "" {
+		return ErrLockLost
+	}
+	err := l.write(time.Now().Add(l.TTL), PutOptions{IfMatch: l.etag})
+	if IsPreconditionFailed(err) {
+		l.etag = ""
+		return ErrLockLost
+	}
+	return err
+}
+
+// Release gives up the lock by expiring its lease, so any other owner can take it over immediately.
+// Releasing is conditional like every other change to the lease: only the lease this lock acquired
+// is released, or, if the lock is Reentrant and didn't acquire the lease itself, the lease belonging
+// to this lock's owner. Otherwise, ErrLockLost is returned.
+func (l *Lock) Release() error {
+	etag := l.etag
+	if etag == "" {
+		if !l.Reentrant {
+			return ErrLockLost
+		}
+
+		// The lease was acquired elsewhere, e.g. by another process with the same owner
+		currentETag, owner, _, err := l.current()
+		if IsNotFound(err) {
+			return ErrLockLost
+		} else if err != nil {
+			return err
+		}
+		if owner != l.Owner {
+			return ErrLockLost
+		}
+		etag = currentETag
+	}
+
+	err := l.write(time.Now(), PutOptions{IfMatch: etag})
+	l.etag = ""
+	if IsPreconditionFailed(err) {
+		return ErrLockLost
+	}
+	return err
+}
@@ -0,0 +1,276 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// stubObject is an object stored by s3Stub.
+type stubObject struct {
+	etag     string
+	metadata http.Header
+}
+
+// s3Stub is an in-memory S3 server storing objects' metadata, written by PUT requests honouring
+// If-Match and If-None-Match, and removed by DELETE requests. failAfterWrite makes that many PUTs
+// fail with 500 Internal Server Error after being applied, as when a write reaches R2 but its
+// response is lost, so the SDK retries it.
+type s3Stub struct {
+	mu             sync.Mutex
+	objects        map[string]*stubObject
+	writes         int
+	failAfterWrite int
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.Copy(io.Discard, r.Body)
+	object := s.objects[r.URL.Path]
+
+	switch r.Method {
+	case http.MethodHead:
+		if object == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for name, values := range object.metadata {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", object.etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPut:
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if (ifNoneMatch == "*" && object != nil) || (ifMatch != "" && (object == nil || object.etag != ifMatch)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, "<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>")
+			return
+		}
+
+		s.writes++
+		metadata := http.Header{}
+		for name, values := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+				metadata[name] = values
+			}
+		}
+		etag := fmt.Sprintf(`"etag-%d"`, s.writes)
+		s.objects[r.URL.Path] = &stubObject{etag: etag, metadata: metadata}
+
+		if s.failAfterWrite > 0 {
+			s.failAfterWrite--
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "<Error><Code>InternalError</Code><Message>We encountered an internal error</Message></Error>")
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// exists reports whether an object is stored at key.
+func (s *s3Stub) exists(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.objects["/bucket/"+key] != nil
+}
+
+// lease returns the owner and expiry time of the lease stored at key.
+func (s *s3Stub) lease(key string) (owner string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object := s.objects["/bucket/"+key]
+	if object == nil {
+		return "", time.Time{}
+	}
+	expires, _ = time.Parse(time.RFC3339Nano, object.metadata.Get("X-Amz-Meta-Lease-Expires"))
+	return object.metadata.Get("X-Amz-Meta-Lease-Owner"), expires
+}
+
+// newStubBucket returns a bucket named "bucket" served by an s3Stub. Failed requests are retried
+// straight away.
+func newStubBucket(t *testing.T) (*R2Bucket, *s3Stub) {
+	t.Helper()
+	stub := &s3Stub{objects: make(map[string]*stubObject)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Region:       "auto",
+		Credentials:  credentials.NewStaticCredentialsProvider("id", "secret", ""),
+		UsePathStyle: true,
+		Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		}),
+	})
+	return &R2Bucket{Client: &R2Client{Client: *client}, Name: "bucket"}, stub
+}
+
+func TestLockHolds(t *testing.T) {
+	tests := []struct {
+		name      string
+		lockETag  string
+		reentrant bool
+		etag      string
+		owner     string
+		want      bool
+	}{
+		{name: "lease written by the lock", lockETag: `"a"`, etag: `"a"`, owner: "other", want: true},
+		{name: "lease changed since", lockETag: `"a"`, etag: `"b"`, owner: "me"},
+		{name: "lock holds no lease", etag: `"a"`, owner: "me"},
+		{name: "same owner, not reentrant", etag: "", owner: "me"},
+		{name: "same owner, reentrant", reentrant: true, etag: `"a"`, owner: "me", want: true},
+		{name: "other owner, reentrant", reentrant: true, etag: `"a"`, owner: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Lock{Owner: "me", Reentrant: tt.reentrant, etag: tt.lockETag}
+			if got := l.holds(tt.etag, tt.owner); got != tt.want {
+				t.Errorf("holds(%q, %q) = %v, want %v", tt.etag, tt.owner, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockExclusive(t *testing.T) {
+	b, _ := newStubBucket(t)
+	first := b.Lock("deploy.lock", "deploy", time.Minute)
+	if err := first.Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// Another lock excludes the holder, even with the same owner name, unless it's reentrant
+	var held *LockHeldError
+	if err := b.Lock("deploy.lock", "other", time.Minute).Acquire(); !errors.As(err, &held) || held.Owner != "deploy" {
+		t.Errorf("Acquire by another owner = %v, want a LockHeldError naming deploy", err)
+	}
+	if err := b.Lock("deploy.lock", "deploy", time.Minute).Acquire(); !errors.As(err, &held) {
+		t.Errorf("Acquire by the same owner name = %v, want a LockHeldError", err)
+	}
+	reentrant := b.Lock("deploy.lock", "deploy", time.Minute)
+	reentrant.Reentrant = true
+	if err := reentrant.Acquire(); err != nil {
+		t.Errorf("reentrant Acquire: %v", err)
+	}
+
+	// The reentrant lock rewrote the lease, so the first lock has lost it
+	if err := first.Renew(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Renew after takeover = %v, want ErrLockLost", err)
+	}
+}
+
+func TestLockTakeoverAfterExpiry(t *testing.T) {
+	b, stub := newStubBucket(t)
+	first := b.Lock("job.lock", "first", 20*time.Millisecond)
+	if err := first.Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	second := b.Lock("job.lock", "second", time.Minute)
+	if err := second.Acquire(); err != nil {
+		t.Fatalf("Acquire of an expired lease: %v", err)
+	}
+	if owner, _ := stub.lease("job.lock"); owner != "second" {
+		t.Errorf("lease owner = %q, want second", owner)
+	}
+
+	// The first owner can neither renew nor release the lease it lost
+	if err := first.Renew(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Renew = %v, want ErrLockLost", err)
+	}
+	if err := first.Release(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release = %v, want ErrLockLost", err)
+	}
+	if err := second.Renew(); err != nil {
+		t.Errorf("Renew by the new owner: %v", err)
+	}
+}
+
+func TestLockRelease(t *testing.T) {
+	b, stub := newStubBucket(t)
+	l := b.Lock("job.lock", "first", time.Hour)
+	if err := l.Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	// Released leases are written already expired, so anyone can take them over straight away
+	owner, expires := stub.lease("job.lock")
+	if owner != "first" || expires.After(time.Now()) {
+		t.Errorf("released lease = %q until %s, want first, already expired", owner, expires)
+	}
+	if err := l.Release(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("second Release = %v, want ErrLockLost", err)
+	}
+	if err := b.Lock("job.lock", "second", time.Hour).Acquire(); err != nil {
+		t.Errorf("Acquire after release: %v", err)
+	}
+}
+
+func TestLockReleaseReentrant(t *testing.T) {
+	b, _ := newStubBucket(t)
+	if err := b.Lock("job.lock", "deploy", time.Hour).Acquire(); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// Another process given the same owner can only release the lease if it's reentrant
+	if err := b.Lock("job.lock", "deploy", time.Hour).Release(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Release by a lock that didn't acquire the lease = %v, want ErrLockLost", err)
+	}
+	other := b.Lock("job.lock", "other", time.Hour)
+	other.Reentrant = true
+	if err := other.Release(); !errors.Is(err, ErrLockLost) {
+		t.Errorf("reentrant Release by another owner = %v, want ErrLockLost", err)
+	}
+	reentrant := b.Lock("job.lock", "deploy", time.Hour)
+	reentrant.Reentrant = true
+	if err := reentrant.Release(); err != nil {
+		t.Errorf("reentrant Release: %v", err)
+	}
+}
+
+func TestLockLostResponse(t *testing.T) {
+	b, stub := newStubBucket(t)
+	l := b.Lock("job.lock", "first", time.Hour)
+
+	// The create reaches R2 but its response is lost, so the retry fails If-None-Match
+	stub.failAfterWrite = 1
+	if err := l.Acquire(); err != nil {
+		t.Fatalf("Acquire with a lost response: %v", err)
+	}
+
+	// Likewise for a renewal and its If-Match
+	stub.failAfterWrite = 1
+	if err := l.Renew(); err != nil {
+		t.Fatalf("Renew with a lost response: %v", err)
+	}
+	if err := l.Renew(); err != nil {
+		t.Errorf("Renew after recovering the lease's ETag: %v", err)
+	}
+
+	// Another owner's lease isn't mistaken for one's own
+	if err := b.Lock("job.lock", "second", time.Hour).Acquire(); err == nil {
+		t.Error("Acquire by another owner succeeded, want a LockHeldError")
+	}
+}
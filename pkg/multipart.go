@@ -0,0 +1,351 @@
+// Multipart operations
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// DefaultMultipartCopyThreshold is the source size above which objects are copied in parts. It
+	// is the largest object a single CopyObject call can copy.
+	DefaultMultipartCopyThreshold int64 = 5 * 1024 * 1024 * 1024
+
+	// DefaultCopyPartSize is the size of each part copied by a multipart copy.
+	DefaultCopyPartSize int64 = 256 * 1024 * 1024
+
+	// DefaultCopyConcurrency is the number of parts copied in parallel by a multipart copy.
+	DefaultCopyConcurrency = 5
+
+	// maxParts is the largest number of parts a multipart upload may have.
+	maxParts = 10000
+)
+
+// putOptionsFromHead returns the PutOptions describing the metadata of an existing object, so the
+// metadata can be carried over to a copy of it.
+func putOptionsFromHead(head *s3.HeadObjectOutput) PutOptions {
+	opts := PutOptions{
+		ContentType:        aws.ToString(head.ContentType),
+		CacheControl:       aws.ToString(head.CacheControl),
+		ContentEncoding:    aws.ToString(head.ContentEncoding),
+		ContentDisposition: aws.ToString(head.ContentDisposition),
+		Metadata:           head.Metadata,
+		StorageClass:       head.StorageClass,
+	}
+	if expires, err := http.ParseTime(aws.ToString(head.ExpiresString)); err == nil {
+		opts.Expires = &expires
+	}
+	return opts
+}
+
+// createMultipartUploadInput returns the input starting a multipart upload of an object with the
+// given PutOptions. The options are applied through PutOptions.apply so that all upload paths agree
+// on how they are sent.
+func createMultipartUploadInput(bucket, key string, opts PutOptions) *s3.CreateMultipartUploadInput {
+	var put s3.PutObjectInput
+	opts.apply(&put)
+	return &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		ContentType:          put.ContentType,
+		CacheControl:         put.CacheControl,
+		ContentEncoding:      put.ContentEncoding,
+		ContentDisposition:   put.ContentDisposition,
+		Expires:              put.Expires,
+		Metadata:             put.Metadata,
+		StorageClass:         put.StorageClass,
+		ChecksumAlgorithm:    put.ChecksumAlgorithm,
+		SSECustomerAlgorithm: put.SSECustomerAlgorithm,
+		SSECustomerKey:       put.SSECustomerKey,
+		SSECustomerKeyMD5:    put.SSECustomerKeyMD5,
+	}
+}
+
+// copyPart is the range of the source copied by a part of a multipart copy.
+type copyPart struct {
+	offset int64
+	length int64
+}
+
+// copyParts splits an object of the given size into the ranges copied by the parts of a
+// multipart copy, in part number order. Parts are partSize bytes (DefaultCopyPartSize if zero),
+// except the last, which holds the remainder. Larger parts are used if the object would otherwise
+// need more than maxParts.
+func copyParts(size, partSize int64) []copyPart {
+	// Use fewer, larger parts if the object would otherwise need too many
+	if partSize <= 0 {
+		partSize = DefaultCopyPartSize
+	}
+	if minPartSize := (size + maxParts - 1) / maxParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	var parts []copyPart
+	for offset := int64(0); offset < size; offset += partSize {
+		parts = append(parts, copyPart{offset: offset, length: min(partSize, size-offset)})
+	}
+	return parts
+}
+
+// multipartCopy copies an object of the given size to another location using UploadPartCopy, which
+// unlike CopyObject has no 5 GiB limit. Parts are copied in parallel, and each part is retried on
+// its own by the client's retryer, so a transient failure doesn't restart the whole copy. If the
+// copy fails, the multipart upload is aborted so no incomplete parts are left behind.
+func (b *R2Bucket) multipartCopy(bucketPath string, size int64, copyToURI R2URI, metadata PutOptions, opts CopyOptions) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	// Start the multipart upload
+	upload, err := b.Client.CreateMultipartUpload(context.TODO(), createMultipartUploadInput(copyToURI.Bucket, copyToURI.Path, metadata))
+	if err != nil {
+		return err
+	}
+
+	// Every part is read from the source and written to the destination with their SSE-C keys
+	sse, sourceSSE := sseCustomer(metadata.SSECustomerKey), sseCustomer(opts.SourceSSECustomerKey)
+
+	// Copy parts in parallel, limiting the number of copies in flight
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []types.CompletedPart
+		firstErr error
+	)
+	uri := fmt.Sprintf("r2://%s/%s", copyToURI.Bucket, copyToURI.Path)
+	semaphore := make(chan struct{}, concurrency)
+	for i, part := range copyParts(size, opts.PartSize) {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(partNumber int32, byteRange string, partLength int64) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			// Skip remaining parts once one has failed
+			mu.Lock()
+			failed := firstErr != nil
+			mu.Unlock()
+			if failed {
+				return
+			}
+
+			output, err := b.Client.UploadPartCopy(context.TODO(), &s3.UploadPartCopyInput{
+				Bucket:          aws.String(copyToURI.Bucket),
+				Key:             aws.String(copyToURI.Path),
+				UploadId:        upload.UploadId,
+				PartNumber:      aws.Int32(partNumber),
+				CopySource:      aws.String(b.Name + "/" + bucketPath),
+				CopySourceRange: aws.String(byteRange),
+
+				SSECustomerAlgorithm:           sse.algorithm,
+				SSECustomerKey:                 sse.key,
+				SSECustomerKeyMD5:              sse.keyMD5,
+				CopySourceSSECustomerAlgorithm: sourceSSE.algorithm,
+				CopySourceSSECustomerKey:       sourceSSE.key,
+				CopySourceSSECustomerKeyMD5:    sourceSSE.keyMD5,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("part %d: %w", partNumber, err)
+				}
+				return
+			}
+			parts = append(parts, types.CompletedPart{
+				ETag:           output.CopyPartResult.ETag,
+				PartNumber:     aws.Int32(partNumber),
+				ChecksumCRC32:  output.CopyPartResult.ChecksumCRC32,
+				ChecksumCRC32C: output.CopyPartResult.ChecksumCRC32C,
+				ChecksumSHA1:   output.CopyPartResult.ChecksumSHA1,
+				ChecksumSHA256: output.CopyPartResult.ChecksumSHA256,
+			})
+			opts.Put.Progress.transferred(uri, partLength)
+		}(int32(i+1), ByteRange(part.offset, part.length), part.length)
+	}
+	wg.Wait()
+
+	// Complete the upload, or abort it if any part failed
+	if firstErr == nil {
+		sort.Slice(parts, func(i, j int) bool { return *parts[i].PartNumber < *parts[j].PartNumber })
+		_, firstErr = b.Client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(copyToURI.Bucket),
+			Key:             aws.String(copyToURI.Path),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+
+			SSECustomerAlgorithm: sse.algorithm,
+			SSECustomerKey:       sse.key,
+			SSECustomerKeyMD5:    sse.keyMD5,
+		})
+	}
+	if firstErr != nil {
+		b.Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(copyToURI.Bucket),
+			Key:      aws.String(copyToURI.Path),
+			UploadId: upload.UploadId,
+		})
+		return firstErr
+	}
+
+	return nil
+}
+
+// MultipartUpload describes an incomplete multipart upload. Incomplete uploads are left behind by
+// uploads that failed or were interrupted, and their parts are stored (and billed) until the upload
+// is completed or aborted.
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+	Parts     int
+	Size      int64
+}
+
+// GetMultipartUploads returns the incomplete multipart uploads in a bucket whose keys have the
+// specified prefix, along with the number and total size of the parts uploaded so far. This method
+// leverages S3's ListMultipartUploads and ListParts API calls, handling pagination of both.
+func (b *R2Bucket) GetMultipartUploads(prefix string) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	var keyMarker, uploadIDMarker *string
+
+	for {
+		input := &s3.ListMultipartUploadsInput{
+			Bucket:         &b.Name,
+			KeyMarker:      keyMarker,
+			UploadIdMarker: uploadIDMarker,
+		}
+		if prefix != "" {
+			input.Prefix = &prefix
+		}
+
+		output, err := b.Client.ListMultipartUploads(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		// Count the parts of each upload on this page
+		for _, u := range output.Uploads {
+			upload := MultipartUpload{
+				Key:       aws.ToString(u.Key),
+				UploadID:  aws.ToString(u.UploadId),
+				Initiated: aws.ToTime(u.Initiated),
+			}
+			parts, err := b.GetParts(upload.Key, upload.UploadID)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't list parts of upload %s of %s: %w", upload.UploadID, upload.Key, err)
+			}
+			upload.Parts = len(parts)
+			for _, part := range parts {
+				upload.Size += aws.ToInt64(part.Size)
+			}
+			uploads = append(uploads, upload)
+		}
+
+		// Check if there are more pages to fetch
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		keyMarker, uploadIDMarker = output.NextKeyMarker, output.NextUploadIdMarker
+	}
+
+	return uploads, nil
+}
+
+// GetParts returns the parts uploaded so far by an incomplete multipart upload. This method leverages
+// S3's ListParts API call, handling pagination for uploads with more than 1000 parts.
+func (b *R2Bucket) GetParts(key, uploadID string) ([]types.Part, error) {
+	var parts []types.Part
+	var partNumberMarker *string
+
+	for {
+		output, err := b.Client.ListParts(context.TODO(), &s3.ListPartsInput{
+			Bucket:           &b.Name,
+			Key:              aws.String(key),
+			UploadId:         aws.String(uploadID),
+			PartNumberMarker: partNumberMarker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, output.Parts...)
+
+		// Check if there are more pages to fetch
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		partNumberMarker = output.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// PrintMultipartUploads prints the incomplete multipart uploads in a bucket whose keys have the
+// specified prefix, formatted as a table with the following columns: initiation date, part count,
+// total part size, upload ID, key.
+func (b *R2Bucket) PrintMultipartUploads(prefix string) error {
+	uploads, err := b.GetMultipartUploads(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, upload := range uploads {
+		fmt.Printf("%s  %5d parts  %10s  %s  %s\n",
+			upload.Initiated.Format("2006-01-02 15:04:05"),
+			upload.Parts,
+			FormatSize(upload.Size),
+			upload.UploadID,
+			upload.Key,
+		)
+	}
+	return nil
+}
+
+// AbortMultipartUpload aborts an incomplete multipart upload, deleting the parts uploaded so far.
+func (b *R2Bucket) AbortMultipartUpload(key, uploadID string) error {
+	_, err := b.Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   &b.Name,
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// AbortMultipartUploads aborts the incomplete multipart uploads in a bucket whose keys have the
+// specified prefix and which were initiated more than olderThan ago. Pass 0 to abort all matching
+// uploads, including any still in progress. Uploads that fail to abort don't stop the remaining ones
+// from being aborted; the uploads that were aborted are returned along with any errors.
+func (b *R2Bucket) AbortMultipartUploads(prefix string, olderThan time.Duration) ([]MultipartUpload, error) {
+	uploads, err := b.GetMultipartUploads(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var aborted []MultipartUpload
+	var errs []error
+	cutoff := time.Now().Add(-olderThan)
+	for _, upload := range uploads {
+		if upload.Initiated.After(cutoff) {
+			continue
+		}
+		if err := b.AbortMultipartUpload(upload.Key, upload.UploadID); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't abort upload %s of %s: %w", upload.UploadID, upload.Key, err))
+			continue
+		}
+		aborted = append(aborted, upload)
+	}
+
+	return aborted, errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import "testing"
+
+func TestCopyParts(t *testing.T) {
+	const gib = 1 << 30
+	tests := []struct {
+		name     string
+		size     int64
+		partSize int64
+		parts    int
+		length   int64
+		last     string
+	}{
+		{name: "exact multiple", size: 1000, partSize: 100, parts: 10, length: 100, last: "bytes=900-999"},
+		{name: "remainder in the last part", size: 1001, partSize: 100, parts: 11, length: 100, last: "bytes=1000-1000"},
+		{name: "smaller than a part", size: 50, partSize: 100, parts: 1, length: 50, last: "bytes=0-49"},
+		{name: "default part size", size: 5*gib + 1, parts: 21, length: DefaultCopyPartSize, last: "bytes=5368709120-5368709120"},
+		{name: "clamped to maxParts", size: maxParts * 100, partSize: 10, parts: maxParts, length: 100, last: "bytes=999900-999999"},
+		{name: "clamped, rounding the part size up", size: maxParts*100 + 1, partSize: 10, parts: 9901, length: 101, last: "bytes=999900-1000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := copyParts(tt.size, tt.partSize)
+			if len(parts) != tt.parts {
+				t.Fatalf("got %d parts, want %d", len(parts), tt.parts)
+			}
+			if parts[0].length != tt.length {
+				t.Errorf("part size = %d, want %d", parts[0].length, tt.length)
+			}
+
+			// Parts cover the object contiguously, each as large as the first but the last
+			var offset int64
+			for i, part := range parts {
+				if part.offset != offset {
+					t.Fatalf("part %d starts at %d, want %d", i+1, part.offset, offset)
+				}
+				if i < len(parts)-1 && part.length != parts[0].length {
+					t.Errorf("part %d is %d bytes, want %d", i+1, part.length, parts[0].length)
+				}
+				offset += part.length
+			}
+			if offset != tt.size {
+				t.Errorf("parts cover %d bytes, want %d", offset, tt.size)
+			}
+
+			last := parts[len(parts)-1]
+			if got := ByteRange(last.offset, last.length); got != tt.last {
+				t.Errorf("last part range = %q, want %q", got, tt.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Transfer progress reporting
+
+package pkg
+
+import (
+	"io"
+)
+
+// ProgressEventType identifies the kind of a ProgressEvent.
+type ProgressEventType int
+
+const (
+	// TransferPlanned is sent once by the sync functions before any transfer begins. Count holds the
+	// number of objects to be transferred and Size their total size in bytes.
+	TransferPlanned ProgressEventType = iota
+
+	// TransferStarted is sent when the transfer of an object begins. Size holds the size of the
+	// object in bytes, or -1 if it isn't known in advance.
+	TransferStarted
+
+	// TransferProgress is sent as an object's bytes are transferred. Bytes holds the number of bytes
+	// transferred since the previous event for the same object.
+	TransferProgress
+
+	// TransferCompleted is sent when the transfer of an object ends. Err holds the error that ended
+	// it, or nil if it succeeded.
+	TransferCompleted
+
+	// ObjectDeleted is sent by syncs to R2 with Delete set when an object is deleted because it no
+	// longer exists in the source. URI holds the object's R2 URI. Err holds the error if the deletion
+	// failed.
+	ObjectDeleted
+)
+
+// ProgressEvent describes a change in the progress of a transfer. URI holds the R2 URI of the object
+// being transferred, e.g. r2://bucket/key; for R2-to-R2 copies it is the URI of the destination.
+type ProgressEvent struct {
+	Type  ProgressEventType
+	URI   string
+	Size  int64
+	Bytes int64
+	Count int
+	Err   error
+}
+
+// ProgressFunc receives progress events from transfers. Multipart transfers report progress from
+// several goroutines, so implementations must be safe for concurrent use.
+type ProgressFunc func(ProgressEvent)
+
+// started reports the start of a transfer, if progress is being reported.
+func (fn ProgressFunc) started(uri string, size int64) {
+	if fn != nil {
+		fn(ProgressEvent{Type: TransferStarted, URI: uri, Size: size})
+	}
+}
+
+// transferred reports bytes transferred, if progress is being reported.
+func (fn ProgressFunc) transferred(uri string, n int64) {
+	if fn != nil && n > 0 {
+		fn(ProgressEvent{Type: TransferProgress, URI: uri, Bytes: n})
+	}
+}
+
+// completed reports the end of a transfer, if progress is being reported.
+func (fn ProgressFunc) completed(uri string, err error) {
+	if fn != nil {
+		fn(ProgressEvent{Type: TransferCompleted, URI: uri, Err: err})
+	}
+}
+
+// deleted reports a deletion, if progress is being reported.
+func (fn ProgressFunc) deleted(uri string, err error) {
+	if fn != nil {
+		fn(ProgressEvent{Type: ObjectDeleted, URI: uri, Err: err})
+	}
+}
+
+// progressReader wraps a reader, reporting the bytes read from it as progress. Only bytes beyond
+// the furthest point read so far are reported, so re-reading a rewound body (e.g. when the SDK
+// computes a payload hash or retries a request) isn't counted twice.
+type progressReader struct {
+	r        io.Reader
+	uri      string
+	progress ProgressFunc
+	pos      int64
+	reported int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pos += int64(n)
+	if p.pos > p.reported {
+		p.progress.transferred(p.uri, p.pos-p.reported)
+		p.reported = p.pos
+	}
+	return n, err
+}
+
+// progressReadSeeker is a progressReader over a seekable reader, which remains seekable so the SDK
+// can determine its length and rewind it.
+type progressReadSeeker struct {
+	*progressReader
+}
+
+func (p progressReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.r.(io.Seeker).Seek(offset, whence)
+	if err == nil {
+		p.pos = pos
+	}
+	return pos, err
+}
+
+// withProgress wraps a reader so that reading from it reports progress for the object with the
+// given URI. Seekable readers remain seekable. If no progress function is given, the reader is
+// returned unchanged.
+func withProgress(r io.Reader, uri string, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return r
+	}
+	p := &progressReader{r: r, uri: uri, progress: progress}
+	if _, ok := r.(io.Seeker); ok {
+		return progressReadSeeker{p}
+	}
+	return p
+}
+
+// readerSize returns the number of bytes remaining in a reader, or -1 if it can't be determined
+// without consuming the reader.
+func readerSize(r io.Reader) int64 {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	current, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := seeker.Seek(current, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - current
+}
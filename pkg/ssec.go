@@ -0,0 +1,86 @@
+// Server-side encryption with customer-provided keys
+
+package pkg
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	smithyHTTP "github.com/aws/smithy-go/transport/http"
+)
+
+// sseCustomerAlgorithm is the only algorithm R2 supports for SSE-C.
+const sseCustomerAlgorithm = "AES256"
+
+// ErrSSECustomerKey is returned when R2 refuses to read an object because the SSE-C key given is
+// wrong, or was given for an object that isn't encrypted with SSE-C.
+var ErrSSECustomerKey = errors.New("wrong SSE-C key, or the object isn't encrypted with SSE-C")
+
+// ErrSSECustomerKeyRequired is returned when R2 refuses to read an object because it is encrypted
+// with SSE-C and no key was given.
+var ErrSSECustomerKeyRequired = errors.New("the object is encrypted with SSE-C and its key is required")
+
+// sseCustomerHeaders holds the values of the headers sending an SSE-C key with a request: the
+// algorithm, the base64-encoded key and the base64-encoded MD5 hash of the key, which R2 uses to
+// check the key arrived intact. All are nil if there is no key.
+type sseCustomerHeaders struct {
+	algorithm *string
+	key       *string
+	keyMD5    *string
+}
+
+// sseCustomer returns the headers sending an SSE-C key with a request. Keys are 256-bit AES keys,
+// parsed with ParseEncryptionKey or LoadEncryptionKey.
+func sseCustomer(key []byte) sseCustomerHeaders {
+	if len(key) == 0 {
+		return sseCustomerHeaders{}
+	}
+	hash := md5.Sum(key)
+	return sseCustomerHeaders{
+		algorithm: aws.String(sseCustomerAlgorithm),
+		key:       aws.String(base64.StdEncoding.EncodeToString(key)),
+		keyMD5:    aws.String(base64.StdEncoding.EncodeToString(hash[:])),
+	}
+}
+
+// sseCustomerError converts an error reading an object into one wrapping ErrSSECustomerKey or
+// ErrSSECustomerKeyRequired, if R2 refused the request because of its SSE-C key, returning other
+// errors unchanged. Refusals with 400 Bad Request or 403 Forbidden are only put down to the key when
+// the response explains them: it carries the SSE-C algorithm of an object encrypted with another key
+// (or when no key was given), or its error message is about encryption. HEAD responses have no body,
+// so refused HEAD requests are only explained by the headers.
+func sseCustomerError(uri string, key []byte, err error) error {
+	var respErr *smithyHTTP.ResponseError
+	if err == nil || !errors.As(err, &respErr) {
+		return err
+	}
+	if status := respErr.HTTPStatusCode(); status != http.StatusForbidden && status != http.StatusBadRequest {
+		return err
+	}
+
+	var explained bool
+	if respErr.Response != nil && respErr.Response.Response != nil {
+		header := respErr.Response.Header
+		algorithm := header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")
+		keyMD5 := header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5")
+		explained = algorithm != "" && (len(key) == 0 || keyMD5 != aws.ToString(sseCustomer(key).keyMD5))
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "encrypt") {
+		explained = true
+	}
+	if !explained {
+		return err
+	}
+
+	if len(key) > 0 {
+		return fmt.Errorf("%s: %w: %w", uri, ErrSSECustomerKey, err)
+	}
+	return fmt.Errorf("%s: %w: %w", uri, ErrSSECustomerKeyRequired, err)
+}
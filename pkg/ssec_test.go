@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+	smithyHTTP "github.com/aws/smithy-go/transport/http"
+)
+
+// responseError returns the error of a refused request with the given status, headers and error
+// message, which is empty for HEAD requests.
+func responseError(status int, header http.Header, message string) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &smithyHTTP.ResponseError{
+		Response: &smithyHTTP.Response{Response: &http.Response{StatusCode: status, Header: header}},
+		Err:      &smithy.GenericAPIError{Code: http.StatusText(status), Message: message},
+	}
+}
+
+func TestSSECustomerError(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, encryptionKeySize)
+	otherKeyMD5 := aws.ToString(sseCustomer(bytes.Repeat([]byte{2}, encryptionKeySize)).keyMD5)
+	encrypted := func(keyMD5 string) http.Header {
+		header := http.Header{}
+		header.Set("x-amz-server-side-encryption-customer-algorithm", sseCustomerAlgorithm)
+		header.Set("x-amz-server-side-encryption-customer-key-MD5", keyMD5)
+		return header
+	}
+
+	tests := []struct {
+		name string
+		key  []byte
+		err  error
+		want error
+	}{
+		{
+			name: "missing key, explained by the message",
+			err:  responseError(http.StatusBadRequest, nil, "The object was stored using a form of Server Side Encryption."),
+			want: ErrSSECustomerKeyRequired,
+		},
+		{
+			name: "missing key, explained by the headers",
+			err:  responseError(http.StatusBadRequest, encrypted(otherKeyMD5), ""),
+			want: ErrSSECustomerKeyRequired,
+		},
+		{
+			name: "wrong key, explained by the headers",
+			key:  key,
+			err:  responseError(http.StatusForbidden, encrypted(otherKeyMD5), ""),
+			want: ErrSSECustomerKey,
+		},
+		{
+			name: "unneeded key, explained by the message",
+			key:  key,
+			err:  responseError(http.StatusBadRequest, nil, "The encryption parameters are not applicable to this object."),
+			want: ErrSSECustomerKey,
+		},
+		{
+			name: "refused HEAD with a key, unexplained",
+			key:  key,
+			err:  responseError(http.StatusForbidden, nil, ""),
+		},
+		{
+			name: "refused HEAD without a key, unexplained",
+			err:  responseError(http.StatusBadRequest, nil, ""),
+		},
+		{
+			name: "access denied with the right key",
+			key:  key,
+			err:  responseError(http.StatusForbidden, encrypted(aws.ToString(sseCustomer(key).keyMD5)), "Access Denied"),
+		},
+		{
+			name: "other status",
+			key:  key,
+			err:  responseError(http.StatusNotFound, encrypted(otherKeyMD5), ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sseCustomerError("r2://bucket/key", tt.key, tt.err)
+			if tt.want == nil {
+				if err != tt.err {
+					t.Errorf("sseCustomerError = %v, want the original error", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("sseCustomerError = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Sync operations
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// SyncOptions holds optional settings for syncing. Put holds the options applied to every object
+// uploaded or copied into R2 by a sync, and Get the options applied to every object downloaded, or
+// read as the source of a copy between R2 locations. If Put.StorageClass is set, unchanged objects
+// in another storage class are transitioned to it in place, without transferring their contents
+// again. Progress, if set, receives a TransferPlanned event once the objects to transfer are known,
+// followed by progress events for each transfer. Delete, if set, deletes objects under the
+// destination that don't exist in the source, sending an ObjectDeleted event for each; it only
+// applies to syncs from a local directory to R2, and is ignored by syncs from R2.
+//
+// If a transfer fails once its retries are exhausted, the sync carries on with the remaining
+// transfers and returns an error listing every failure at the end.
+type SyncOptions struct {
+	Put      PutOptions
+	Get      GetOptions
+	Delete   bool
+	Progress ProgressFunc
+}
+
+// syncTransfer is an object transfer planned by a sync. Source and dest hold local paths or object
+// keys, depending on the direction of the sync. Transitions only change the storage class of the
+// destination object, and deletions delete it, so neither transfers any data.
+type syncTransfer struct {
+	source     string
+	dest       string
+	size       int64
+	transition bool
+	delete     bool
+}
+
+// planned reports the number and total size of the transfers in a plan, if progress is being
+// reported. Transitions and deletions aren't counted, as they transfer no data.
+func (opts SyncOptions) planned(transfers []syncTransfer) {
+	if opts.Progress == nil {
+		return
+	}
+	var count int
+	var size int64
+	for _, t := range transfers {
+		if !t.transition && !t.delete {
+			count++
+			size += t.size
+		}
+	}
+	opts.Progress(ProgressEvent{Type: TransferPlanned, Count: count, Size: size})
+}
+
+// syncTransferError is returned by syncs whose transfers failed, as opposed to syncs that failed to
+// compare the source and destination.
+type syncTransferError struct {
+	errs  []error
+	total int
+}
+
+func (e *syncTransferError) Error() string {
+	return fmt.Sprintf("%d of %d transfers failed:\n%v", len(e.errs), e.total, errors.Join(e.errs...))
+}
+
+func (e *syncTransferError) Unwrap() []error {
+	return e.errs
+}
+
+// syncError returns an error summarizing the failed transfers of a sync, or nil if none failed.
+// Syncs carry on past failed transfers, so that one object failing after all retries doesn't stop
+// the others from being synced.
+func syncError(errs []error, total int) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &syncTransferError{errs: errs, total: total}
+}
+
+// SyncLocalToR2 syncs a local directory to an R2 bucket. The sourcePath argument takes the path to
+// the local directory to sync. This method iterates through the local directory and uploads any new
+// or changed files to the bucket.
+func (b *R2Bucket) SyncLocalToR2(sourcePath string) {
+	b.SyncLocalToR2WithPrefix(sourcePath, "")
+}
+
+// SyncLocalToR2WithPrefix syncs a local directory to an R2 bucket with a specific prefix.
+// The sourcePath argument takes the path to the local directory to sync.
+// The prefix argument specifies the prefix to add to all uploaded objects.
+func (b *R2Bucket) SyncLocalToR2WithPrefix(sourcePath string, prefix string) {
+	err := b.SyncLocalToR2WithOptions(sourcePath, prefix, SyncOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// SyncLocalToR2WithOptions syncs a local directory to an R2 bucket with a specific prefix, applying
+// the given SyncOptions. Unlike SyncLocalToR2WithPrefix, errors are returned rather than terminating
+// the program.
+func (b *R2Bucket) SyncLocalToR2WithOptions(sourcePath string, prefix string, opts SyncOptions) error {
+	// Compare the local directory to the objects with the prefix, planning the necessary transfers
+	entries, err := b.diffLocalToR2(sourcePath, prefix, opts.Put.SSECustomerKey)
+	if err != nil {
+		return err
+	}
+	prefix = dirPrefix(prefix)
+	var transfers []syncTransfer
+	for _, entry := range entries {
+		switch {
+		case entry.Status == DiffOnlyInSource || entry.Status == DiffChanged:
+			transfers = append(transfers, syncTransfer{source: entry.source.path, dest: prefix + entry.Path, size: entry.source.size})
+		case entry.Status == DiffUnchanged && opts.Put.StorageClass != "" && objectStorageClass(*entry.dest.object) != opts.Put.StorageClass:
+			// Transition unchanged objects to the requested storage class
+			transfers = append(transfers, syncTransfer{source: entry.source.path, dest: entry.dest.path, transition: true})
+		case entry.Status == DiffOnlyInDest && opts.Delete:
+			transfers = append(transfers, syncTransfer{dest: entry.dest.path, delete: true})
+		}
+	}
+
+	// Carry out the planned transfers
+	opts.planned(transfers)
+	putOpts := opts.Put
+	putOpts.Progress = opts.Progress
+	var errs []error
+	for _, t := range transfers {
+		if t.delete {
+			err = b.DeleteObject(t.dest)
+			opts.Progress.deleted(fmt.Sprintf("r2://%s/%s", b.Name, t.dest), err)
+		} else if t.transition {
+			err = b.SetStorageClass(t.dest, opts.Put.StorageClass, opts.Put.SSECustomerKey)
+		} else {
+			err = b.UploadWithOptions(t.source, t.dest, putOpts)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return syncError(errs, len(transfers))
+}
+
+// SyncR2ToLocal syncs an R2 bucket to a local directory. The destinationPath argument takes the
+// path to the local directory to sync. This method iterates through the bucket and downloads any
+// new or changed files to the local directory.
+func (b *R2Bucket) SyncR2ToLocal(destinationPath string) {
+	b.SyncR2ToLocalWithPrefix(destinationPath, "")
+}
+
+// SyncR2ToLocalWithPrefix syncs objects from an R2 bucket with a specific prefix to a local directory.
+// The destinationPath argument takes the path to the local directory to sync.
+// The prefix argument specifies which objects to sync (only objects with this prefix).
+func (b *R2Bucket) SyncR2ToLocalWithPrefix(destinationPath string, prefix string) {
+	err := b.SyncR2ToLocalWithOptions(destinationPath, prefix, SyncOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// SyncR2ToLocalWithOptions syncs objects from an R2 bucket with a specific prefix to a local
+// directory, applying the given SyncOptions. Unlike SyncR2ToLocalWithPrefix, errors are returned
+// rather than terminating the program.
+func (b *R2Bucket) SyncR2ToLocalWithOptions(destinationPath string, prefix string, opts SyncOptions) error {
+	// Compare the objects with the prefix to the local directory, planning the necessary downloads
+	entries, err := b.diffR2ToLocal(destinationPath, prefix, opts.Get.SSECustomerKey)
+	if err != nil {
+		return err
+	}
+	absDestPath, err := filepath.Abs(destinationPath)
+	if err != nil {
+		return fmt.Errorf("could not resolve destination path %s: %w", destinationPath, err)
+	}
+	var transfers []syncTransfer
+	for _, entry := range entries {
+		if entry.Status != DiffOnlyInSource && entry.Status != DiffChanged {
+			continue
+		}
+
+		// Security check: ensure the path is within the destination directory
+		localPath := filepath.Join(destinationPath, filepath.FromSlash(entry.Path))
+		absLocalPath, err := filepath.Abs(localPath)
+		if err != nil {
+			log.Printf("Warning: could not resolve path %s: %v", localPath, err)
+			continue
+		}
+		if !strings.HasPrefix(absLocalPath, absDestPath+string(filepath.Separator)) {
+			log.Printf("Warning: skipping file %s - path traversal detected", entry.source.path)
+			continue
+		}
+
+		transfers = append(transfers, syncTransfer{source: entry.source.path, dest: localPath, size: entry.source.size})
+	}
+
+	// Carry out the planned downloads
+	opts.planned(transfers)
+	getOpts := opts.Get
+	getOpts.Progress = opts.Progress
+	var errs []error
+	for _, t := range transfers {
+		ensureDirExists(t.dest)
+		if err := b.DownloadWithOptions(t.source, t.dest, getOpts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return syncError(errs, len(transfers))
+}
+
+// SyncR2ToR2 syncs an R2 bucket to another R2 bucket. The destBucket argument takes the bucket to
+// sync to. This method iterates through the bucket and copies any new or changed files to the
+// destination bucket.
+func (b *R2Bucket) SyncR2ToR2(destBucket R2Bucket) {
+	b.SyncR2ToR2WithPrefix(destBucket, "", "")
+}
+
+// SyncR2ToR2WithPrefix syncs objects from an R2 bucket with a specific prefix to another R2 bucket.
+// The sourcePrefix specifies which objects to sync from the source bucket.
+// The destPrefix specifies the prefix to add to objects in the destination bucket.
+func (b *R2Bucket) SyncR2ToR2WithPrefix(destBucket R2Bucket, sourcePrefix string, destPrefix string) {
+	err := b.SyncR2ToR2WithOptions(destBucket, sourcePrefix, destPrefix, SyncOptions{})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// SyncR2ToR2WithOptions syncs objects from an R2 bucket with a specific prefix to another R2 bucket
+// with a specific prefix, applying the given SyncOptions. Unlike SyncR2ToR2WithPrefix, errors are
+// returned rather than terminating the program.
+func (b *R2Bucket) SyncR2ToR2WithOptions(destBucket R2Bucket, sourcePrefix string, destPrefix string, opts SyncOptions) error {
+	// Copies happen server-side, so the data can't be compressed on the way
+	if opts.Put.Compress != "" {
+		return fmt.Errorf("compression isn't supported for syncs between R2 locations")
+	}
+
+	// Copies keep the source objects' metadata, so metadata options would be ignored
+	if opts.Put.hasMetadata() {
+		return fmt.Errorf("object metadata can't be set on syncs between R2 locations, which keep the source objects' metadata")
+	}
+
+	// Compare the objects with the source prefix to those with the destination prefix, planning the
+	// necessary copies
+	entries, err := b.diffR2ToR2(destBucket, sourcePrefix, destPrefix, opts.Get.SSECustomerKey, opts.Put.SSECustomerKey)
+	if err != nil {
+		return err
+	}
+	destPrefix = dirPrefix(destPrefix)
+	var transfers []syncTransfer
+	for _, entry := range entries {
+		switch {
+		case entry.Status == DiffOnlyInSource || entry.Status == DiffChanged:
+			transfers = append(transfers, syncTransfer{source: entry.source.path, dest: destPrefix + entry.Path, size: entry.source.size})
+		case entry.Status == DiffUnchanged && opts.Put.StorageClass != "" && objectStorageClass(*entry.dest.object) != opts.Put.StorageClass:
+			// Transition unchanged objects to the requested storage class
+			transfers = append(transfers, syncTransfer{source: entry.source.path, dest: entry.dest.path, transition: true})
+		}
+	}
+
+	// Carry out the planned copies
+	opts.planned(transfers)
+	copyOpts := CopyOptions{Put: opts.Put, SourceSSECustomerKey: opts.Get.SSECustomerKey}
+	copyOpts.Put.Progress = opts.Progress
+	var errs []error
+	for _, t := range transfers {
+		var err error
+		if t.transition {
+			err = destBucket.SetStorageClass(t.dest, opts.Put.StorageClass, opts.Put.SSECustomerKey)
+		} else {
+			err = b.CopyWithOptions(t.source, R2URI{Bucket: destBucket.Name, Path: t.dest}, copyOpts)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return syncError(errs, len(transfers))
+}
@@ -0,0 +1,180 @@
+// Hierarchical object views
+
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// TreeNode is a virtual directory or object in a tree built from "/"-delimited keys. Directory names
+// end in "/". Size and Objects roll up the sizes and number of all objects at or below the node,
+// including those deeper than the tree was built to.
+type TreeNode struct {
+	Name     string
+	Size     int64
+	Objects  int64
+	Children []*TreeNode
+
+	// index maps the names of children to the children, while the tree is being built
+	index map[string]*TreeNode
+}
+
+// IsDir reports whether the node is a virtual directory.
+func (n *TreeNode) IsDir() bool {
+	return strings.HasSuffix(n.Name, "/")
+}
+
+// child returns the node's child with the given name, adding it if it doesn't exist yet.
+func (n *TreeNode) child(name string) *TreeNode {
+	if n.index == nil {
+		n.index = make(map[string]*TreeNode)
+	}
+	c, ok := n.index[name]
+	if !ok {
+		c = &TreeNode{Name: name}
+		n.index[name] = c
+		n.Children = append(n.Children, c)
+	}
+	return c
+}
+
+// add counts an object of the given size at the node, whose key relative to the node is key. The
+// object is added below the node with the directories on its path, up to depth levels below the
+// node (0 for unlimited), and counted in each node it's added to.
+func (n *TreeNode) add(key string, size int64, depth int) {
+	n.Size += size
+	n.Objects++
+
+	// Walk down the object's path, adding directories as needed
+	segments := strings.Split(key, "/")
+	node := n
+	for level, segment := range segments {
+		if depth > 0 && level >= depth {
+			break
+		}
+
+		last := level == len(segments)-1
+		if last && segment == "" {
+			// Keys ending in "/" are directory markers, not objects of their own
+			break
+		}
+		name := segment
+		if !last {
+			name += "/"
+		}
+
+		node = node.child(name)
+		node.Size += size
+		node.Objects++
+	}
+}
+
+// sort orders the children of the node and its descendants by name, and drops the indexes used to
+// build the tree.
+func (n *TreeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	n.index = nil
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// Tree builds a tree of the virtual directories and objects under the specified prefix, up to depth
+// levels below it (0 for unlimited). Objects deeper than depth aren't added to the tree, but are
+// still counted in their ancestors' rollups. The prefix is treated as a directory, as in sync, so
+// "logs" covers logs/a but not logs2/a, and names the root. Objects are walked a page at a time, so
+// memory use is bounded by the size of the tree rather than the number of objects.
+func (b *R2Bucket) Tree(prefix string, depth int) (*TreeNode, error) {
+	prefix = dirPrefix(prefix)
+	root := &TreeNode{Name: prefix}
+
+	err := b.WalkObjectsWithPrefix(prefix, func(object types.Object) error {
+		root.add(strings.TrimPrefix(aws.ToString(object.Key), prefix), aws.ToInt64(object.Size), depth)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	root.sort()
+	return root, nil
+}
+
+// TreeOptions holds settings for printing trees. Depth limits the levels shown below the root (0 for
+// unlimited), DirsOnly hides objects so only virtual directories are shown, and Sizes shows each
+// node's size and, for directories, object count.
+type TreeOptions struct {
+	Depth    int
+	DirsOnly bool
+	Sizes    bool
+}
+
+// PrintTree prints a Unicode tree of the virtual directories and objects under the specified prefix,
+// followed by the number of directories and objects shown.
+func (b *R2Bucket) PrintTree(prefix string, opts TreeOptions) error {
+	root, err := b.Tree(prefix, opts.Depth)
+	if err != nil {
+		return err
+	}
+
+	printTree(os.Stdout, b.Name, root, opts)
+	return nil
+}
+
+// printTree writes a tree built from the objects in the named bucket, as printed by PrintTree.
+func printTree(w io.Writer, bucket string, root *TreeNode, opts TreeOptions) {
+	fmt.Fprintf(w, "r2://%s/%s%s\n", bucket, root.Name, treeNodeSizes(root, opts, true))
+	var dirs, objects int
+	printTreeChildren(w, root, "", opts, &dirs, &objects)
+
+	fmt.Fprintf(w, "\n%d directories", dirs)
+	if !opts.DirsOnly {
+		fmt.Fprintf(w, ", %d objects", objects)
+	}
+	fmt.Fprintln(w)
+}
+
+// printTreeChildren writes the children of a tree node, each line starting with indent, counting the
+// directories and objects written.
+func printTreeChildren(w io.Writer, node *TreeNode, indent string, opts TreeOptions, dirs, objects *int) {
+	var children []*TreeNode
+	for _, c := range node.Children {
+		if c.IsDir() || !opts.DirsOnly {
+			children = append(children, c)
+		}
+	}
+
+	for i, c := range children {
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(children)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		fmt.Fprintln(w, indent+branch+c.Name+treeNodeSizes(c, opts, c.IsDir()))
+
+		if c.IsDir() {
+			*dirs++
+			printTreeChildren(w, c, nextIndent, opts, dirs, objects)
+		} else {
+			*objects++
+		}
+	}
+}
+
+// treeNodeSizes formats the size rollup of a tree node, if sizes are being shown. Directories also
+// show the number of objects they contain.
+func treeNodeSizes(node *TreeNode, opts TreeOptions, dir bool) string {
+	if !opts.Sizes {
+		return ""
+	}
+	if dir {
+		return fmt.Sprintf("  [%s, %d objects]", FormatSize(node.Size), node.Objects)
+	}
+	return fmt.Sprintf("  [%s]", FormatSize(node.Size))
+}
@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// treeObject is an object added to a tree in tests.
+type treeObject struct {
+	key  string
+	size int64
+}
+
+// buildTree builds a tree named "logs/" of the given objects, whose keys are relative to it.
+func buildTree(objects []treeObject, depth int) *TreeNode {
+	root := &TreeNode{Name: "logs/"}
+	for _, object := range objects {
+		root.add(object.key, object.size, depth)
+	}
+	root.sort()
+	return root
+}
+
+// formatTree formats a node and its descendants as "name size objects" lines, indented by level.
+func formatTree(node *TreeNode, indent string) []string {
+	lines := []string{fmt.Sprintf("%s%s %d %d", indent, node.Name, node.Size, node.Objects)}
+	for _, c := range node.Children {
+		lines = append(lines, formatTree(c, indent+"  ")...)
+	}
+	return lines
+}
+
+func TestTreeAdd(t *testing.T) {
+	objects := []treeObject{
+		{"top.txt", 1},
+		{"a/x.txt", 3},
+		{"a/b/c/d.txt", 5},
+		{"a/b/c/e/f.txt", 7},
+	}
+	tests := []struct {
+		name    string
+		objects []treeObject
+		depth   int
+		want    []string
+	}{
+		{
+			name:    "unlimited depth",
+			objects: objects,
+			want: []string{
+				"logs/ 16 4",
+				"  a/ 15 3",
+				"    b/ 12 2",
+				"      c/ 12 2",
+				"        d.txt 5 1",
+				"        e/ 7 1",
+				"          f.txt 7 1",
+				"    x.txt 3 1",
+				"  top.txt 1 1",
+			},
+		},
+		{
+			// Directories at the cutoff still roll up the objects below it
+			name:    "depth cutoff",
+			objects: objects,
+			depth:   2,
+			want: []string{
+				"logs/ 16 4",
+				"  a/ 15 3",
+				"    b/ 12 2",
+				"    x.txt 3 1",
+				"  top.txt 1 1",
+			},
+		},
+		{
+			name:    "depth 1",
+			objects: objects,
+			depth:   1,
+			want: []string{
+				"logs/ 16 4",
+				"  a/ 15 3",
+				"  top.txt 1 1",
+			},
+		},
+		{
+			// Markers add their directory, but no object node of their own
+			name: "directory markers",
+			objects: []treeObject{
+				{"a/", 0},
+				{"a/f.txt", 4},
+				{"empty/", 0},
+				{"empty/sub/", 0},
+			},
+			want: []string{
+				"logs/ 4 4",
+				"  a/ 4 2",
+				"    f.txt 4 1",
+				"  empty/ 0 2",
+				"    sub/ 0 1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatTree(buildTree(tt.objects, tt.depth), "")
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tree =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPrintTree(t *testing.T) {
+	root := buildTree([]treeObject{
+		{"top.txt", 1},
+		{"a/x.txt", 3},
+		{"a/b/y.txt", 5},
+		{"empty/", 0},
+	}, 0)
+
+	tests := []struct {
+		name string
+		opts TreeOptions
+		want string
+	}{
+		{
+			name: "objects and directories",
+			want: `r2://bucket/logs/
+├── a/
+│   ├── b/
+│   │   └── y.txt
+│   └── x.txt
+├── empty/
+└── top.txt
+
+3 directories, 3 objects
+`,
+		},
+		{
+			// Only the directories shown are counted
+			name: "directories only",
+			opts: TreeOptions{DirsOnly: true},
+			want: `r2://bucket/logs/
+├── a/
+│   └── b/
+└── empty/
+
+3 directories
+`,
+		},
+		{
+			name: "sizes",
+			opts: TreeOptions{DirsOnly: true, Sizes: true},
+			want: `r2://bucket/logs/  [9 B, 4 objects]
+├── a/  [8 B, 2 objects]
+│   └── b/  [5 B, 1 objects]
+└── empty/  [0 B, 1 objects]
+
+3 directories
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			printTree(&out, "bucket", root, tt.opts)
+			if out.String() != tt.want {
+				t.Errorf("printTree =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
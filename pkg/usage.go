@@ -0,0 +1,167 @@
+// Storage usage
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Usage is the number of objects in part of a bucket and their total size in bytes.
+type Usage struct {
+	Objects int64
+	Size    int64
+}
+
+// add counts an object of the given size.
+func (u *Usage) add(size int64) {
+	u.Objects++
+	u.Size += size
+}
+
+// PrefixUsage is the storage used by the objects under a prefix, in total and split by storage
+// class.
+type PrefixUsage struct {
+	Prefix  string
+	Total   Usage
+	Classes map[types.StorageClass]Usage
+}
+
+// add counts an object in the given storage class.
+func (u *PrefixUsage) add(size int64, class types.StorageClass) {
+	u.Total.add(size)
+	classUsage := u.Classes[class]
+	classUsage.add(size)
+	u.Classes[class] = classUsage
+}
+
+// diskUsage aggregates the storage used by the objects under a prefix, by "directory" up to depth
+// levels below the prefix, as returned by DiskUsage.
+type diskUsage struct {
+	prefix string
+	depth  int
+	total  *PrefixUsage
+	dirs   map[string]*PrefixUsage
+}
+
+// newDiskUsage returns an empty aggregate of the storage used under a prefix, which must end in "/"
+// unless it's empty.
+func newDiskUsage(prefix string, depth int) *diskUsage {
+	return &diskUsage{
+		prefix: prefix,
+		depth:  depth,
+		total:  &PrefixUsage{Prefix: prefix, Classes: make(map[types.StorageClass]Usage)},
+		dirs:   make(map[string]*PrefixUsage),
+	}
+}
+
+// add counts an object under the prefix in the total and in each directory containing it, up to
+// the aggregate's depth.
+func (u *diskUsage) add(object types.Object) {
+	key := aws.ToString(object.Key)
+	size := aws.ToInt64(object.Size)
+	class := objectStorageClass(object)
+	u.total.add(size, class)
+
+	segments := strings.Split(strings.TrimPrefix(key, u.prefix), "/")
+	dir := u.prefix
+	for level := 0; level < u.depth && level < len(segments)-1; level++ {
+		dir += segments[level] + "/"
+		usage, ok := u.dirs[dir]
+		if !ok {
+			usage = &PrefixUsage{Prefix: dir, Classes: make(map[types.StorageClass]Usage)}
+			u.dirs[dir] = usage
+		}
+		usage.add(size, class)
+	}
+}
+
+// usages returns the usage of each directory, sorted by size, largest first, followed by the
+// prefix's total.
+func (u *diskUsage) usages() []PrefixUsage {
+	usages := make([]PrefixUsage, 0, len(u.dirs)+1)
+	for _, usage := range u.dirs {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Total.Size != usages[j].Total.Size {
+			return usages[i].Total.Size > usages[j].Total.Size
+		}
+		return usages[i].Prefix < usages[j].Prefix
+	})
+	return append(usages, *u.total)
+}
+
+// DiskUsage returns the storage used by the objects with the specified prefix, aggregated by
+// "directory" up to depth levels below the prefix. Directories are the key prefixes ending in "/",
+// so with depth 2, usage is reported for the prefix itself and for each prefix/a/ and prefix/a/b/.
+// The prefix is treated as a directory, as in sync, so "logs" covers logs/a but not logs2/a.
+// Results are sorted by size, largest first, except for the prefix's own total, which comes last.
+// Objects are walked a page at a time, so only the aggregates are held in memory.
+func (b *R2Bucket) DiskUsage(prefix string, depth int) ([]PrefixUsage, error) {
+	prefix = dirPrefix(prefix)
+	usage := newDiskUsage(prefix, depth)
+	err := b.WalkObjectsWithPrefix(prefix, func(object types.Object) error {
+		usage.add(object)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage.usages(), nil
+}
+
+// PrintDiskUsage prints the storage used by the objects with the specified prefix, as returned by
+// DiskUsage, formatted as a table with the following columns: total size, object count, size in each
+// storage class present, R2 URI.
+func (b *R2Bucket) PrintDiskUsage(prefix string, depth int) error {
+	usages, err := b.DiskUsage(prefix, depth)
+	if err != nil {
+		return err
+	}
+
+	// Find the storage classes present, which all rows show
+	classSet := make(map[types.StorageClass]bool)
+	for _, usage := range usages {
+		for class := range usage.Classes {
+			classSet[class] = true
+		}
+	}
+	var classes []types.StorageClass
+	for class := range classSet {
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+
+	// Format each row's columns
+	var rows [][]string
+	for _, usage := range usages {
+		row := []string{FormatSize(usage.Total.Size), fmt.Sprintf("%d objects", usage.Total.Objects)}
+		for _, class := range classes {
+			row = append(row, fmt.Sprintf("%s %s", class, FormatSize(usage.Classes[class].Size)))
+		}
+		rows = append(rows, append(row, fmt.Sprintf("r2://%s/%s", b.Name, usage.Prefix)))
+	}
+
+	// Right-align every column but the URI
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, value := range row {
+			if len(value) > widths[i] {
+				widths[i] = len(value)
+			}
+		}
+	}
+	for _, row := range rows {
+		for i, value := range row[:len(row)-1] {
+			fmt.Print(strings.Repeat(" ", widths[i]-len(value)), value, "  ")
+		}
+		fmt.Println(row[len(row)-1])
+	}
+
+	return nil
+}
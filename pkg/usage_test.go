@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// formatUsage formats a prefix's usage as "prefix objects size class=size...", classes in order.
+func formatUsage(usage PrefixUsage) string {
+	var classes []string
+	for class, classUsage := range usage.Classes {
+		classes = append(classes, fmt.Sprintf("%s=%d/%d", class, classUsage.Objects, classUsage.Size))
+	}
+	sort.Strings(classes)
+	return strings.Join(append([]string{usage.Prefix, fmt.Sprint(usage.Total.Objects), fmt.Sprint(usage.Total.Size)}, classes...), " ")
+}
+
+func TestDiskUsage(t *testing.T) {
+	objects := []types.Object{
+		{Key: aws.String("logs/top.txt"), Size: aws.Int64(10)},
+		{Key: aws.String("logs/a/1"), Size: aws.Int64(100), StorageClass: types.ObjectStorageClassStandard},
+		{Key: aws.String("logs/a/2"), Size: aws.Int64(50), StorageClass: "STANDARD_IA"},
+		{Key: aws.String("logs/a/b/3"), Size: aws.Int64(7)},
+		{Key: aws.String("logs/c/d/e/4"), Size: aws.Int64(1000), StorageClass: "STANDARD_IA"},
+	}
+	total := "logs/ 5 1167 STANDARD=3/117 STANDARD_IA=2/1050"
+
+	tests := []struct {
+		name  string
+		depth int
+		want  []string
+	}{
+		{
+			name:  "depth 0",
+			depth: 0,
+			want:  []string{total},
+		},
+		{
+			name:  "depth 1",
+			depth: 1,
+			want: []string{
+				"logs/c/ 1 1000 STANDARD_IA=1/1000",
+				"logs/a/ 3 157 STANDARD=2/107 STANDARD_IA=1/50",
+				total,
+			},
+		},
+		{
+			name:  "depth 2",
+			depth: 2,
+			want: []string{
+				"logs/c/ 1 1000 STANDARD_IA=1/1000",
+				"logs/c/d/ 1 1000 STANDARD_IA=1/1000",
+				"logs/a/ 3 157 STANDARD=2/107 STANDARD_IA=1/50",
+				"logs/a/b/ 1 7 STANDARD=1/7",
+				total,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := newDiskUsage("logs/", tt.depth)
+			for _, object := range objects {
+				usage.add(object)
+			}
+			var got []string
+			for _, prefixUsage := range usage.usages() {
+				got = append(got, formatUsage(prefixUsage))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("usages =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiskUsageBucketRoot(t *testing.T) {
+	// Keys directly under the prefix only count towards its total, at any depth
+	usage := newDiskUsage("", 3)
+	for _, key := range []string{"a", "b", "dir/c"} {
+		usage.add(types.Object{Key: aws.String(key), Size: aws.Int64(1)})
+	}
+	var got []string
+	for _, prefixUsage := range usage.usages() {
+		got = append(got, formatUsage(prefixUsage))
+	}
+	want := []string{"dir/ 1 1 STANDARD=1/1", " 3 3 STANDARD=3/3"}
+	if !slices.Equal(got, want) {
+		t.Errorf("usages = %q, want %q", got, want)
+	}
+}
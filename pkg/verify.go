@@ -0,0 +1,348 @@
+// Integrity verification
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// defaultVerifyConcurrency is the number of files verified in parallel by Verify.
+const defaultVerifyConcurrency = 8
+
+// VerifyStatus is the outcome of verifying a file against its copy in R2.
+type VerifyStatus string
+
+const (
+	// VerifyOK is used for files whose copy in R2 has the same contents
+	VerifyOK VerifyStatus = "ok"
+	// VerifyMissing is used for local files with no copy in R2
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyCorrupt is used for files whose copy in R2 has different contents
+	VerifyCorrupt VerifyStatus = "corrupt"
+	// VerifyExtra is used for objects in R2 with no local file
+	VerifyExtra VerifyStatus = "extra"
+	// VerifyUnverified is used for files whose copy couldn't be checked, e.g. because the part size
+	// of a multipart object couldn't be determined
+	VerifyUnverified VerifyStatus = "unverified"
+)
+
+// VerifyOptions holds optional settings for verifying. Objects are read with SSECustomerKey, if they
+// are encrypted with SSE-C. Fix uploads missing and corrupt files again, using the options in Put,
+// and Delete (with Fix) deletes extra objects. Files are verified Concurrency at a time, defaulting
+// to 8.
+type VerifyOptions struct {
+	SSECustomerKey []byte
+	Fix            bool
+	Delete         bool
+	Put            PutOptions
+	Concurrency    int
+}
+
+// VerifyResult is the outcome of verifying a path, relative to the verified directory and prefix.
+// Method is the hash the contents were compared with: "md5" or "multipart-md5" for ETags, or the
+// algorithm of a stored checksum, e.g. "sha256", prefixed with "encrypted-" for objects encrypted
+// client-side, or "download-md5" for objects compressed client-side. Detail explains failures, and
+// Fixed is set once a failure has been fixed.
+type VerifyResult struct {
+	Path   string       `json:"path"`
+	Status VerifyStatus `json:"status"`
+	Method string       `json:"method,omitempty"`
+	Detail string       `json:"detail,omitempty"`
+	Fixed  bool         `json:"fixed,omitempty"`
+
+	// local is the local file of the path, if any
+	local *syncEntry
+}
+
+// Verify checks every file in a local directory against its copy under a prefix in the bucket,
+// returning a result for every file and object, sorted by path.
+//
+// Unlike sync, which trusts that matching ETags mean matching contents, Verify hashes every local
+// file again. Files are compared against the strongest checksum stored with their object (SHA-256,
+// SHA-1, CRC32C or CRC32), or its ETag otherwise. Objects uploaded in multiple parts have ETags and
+// checksums computed from their parts, so the local file is hashed in parts of the same size, which
+// costs an extra request per object. Objects encrypted client-side are checked against the local
+// file encrypted again with the salt in their header, which costs a request to read it. Compressed
+// objects are downloaded and compared with the local file by their contents.
+//
+// Errors verifying a file are recorded in its result rather than returned; the returned error is
+// for listing failures, or failures fixing files if opts.Fix is set.
+func (b *R2Bucket) Verify(localPath string, prefix string, opts VerifyOptions) ([]VerifyResult, error) {
+	prefix = dirPrefix(prefix)
+	local, err := localSyncEntries(localPath)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := b.objectSyncEntries(prefix, opts.SSECustomerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pair files with objects without comparing them, as every file is hashed while it's verified
+	entries := pairSyncEntries(local, objects)
+
+	results := make([]VerifyResult, len(entries))
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultVerifyConcurrency
+	}
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i, entry := range entries {
+		results[i] = VerifyResult{Path: entry.Path, local: entry.source}
+		switch entry.Status {
+		case DiffOnlyInSource:
+			results[i].Status = VerifyMissing
+		case DiffOnlyInDest:
+			results[i].Status = VerifyExtra
+		default:
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(result *VerifyResult, entry DiffEntry) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				b.verifyFile(result, entry.source, entry.dest)
+			}(&results[i], entry)
+		}
+	}
+	wg.Wait()
+
+	if !opts.Fix {
+		return results, nil
+	}
+
+	// Upload missing and corrupt files again, and delete extra objects if requested
+	var errs []error
+	for i := range results {
+		result := &results[i]
+		key := prefix + result.Path
+		switch {
+		case result.Status == VerifyMissing || result.Status == VerifyCorrupt:
+			err = b.UploadWithOptions(result.local.path, key, opts.Put)
+		case result.Status == VerifyExtra && opts.Delete:
+			err = b.DeleteObject(key)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			result.Fixed = true
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// verifyFile compares a local file against its object, filling in the result.
+func (b *R2Bucket) verifyFile(result *VerifyResult, local, object *syncEntry) {
+	fail := func(status VerifyStatus, format string, a ...any) {
+		result.Status = status
+		result.Detail = fmt.Sprintf(format, a...)
+	}
+
+	head, err := b.StatWithOptions(object.path, GetOptions{SSECustomerKey: object.sseKey})
+	if err != nil {
+		fail(VerifyUnverified, "couldn't get metadata: %v", err)
+		return
+	}
+	size := aws.ToInt64(head.ContentLength)
+	if isTransformed(head) {
+		size, _, _ = uploadedData(head)
+	}
+	if local.size != size {
+		fail(VerifyCorrupt, "size is %d bytes, expected %d", size, local.size)
+		return
+	}
+
+	// Compressed data can't be reproduced exactly from the local file, so compressed objects are
+	// downloaded and compared by their contents
+	if objectCompression(head.Metadata) != "" {
+		b.verifyDownload(result, local, object)
+		return
+	}
+
+	// Prefer stored checksums to ETags, which are only MD5 hashes
+	algorithm, stored := objectChecksum(head)
+	if algorithm != "" {
+		result.Method = strings.ToLower(string(algorithm))
+	} else {
+		stored = strings.Trim(aws.ToString(head.ETag), `"`)
+		result.Method = "md5"
+	}
+
+	// Objects encrypted client-side are checked against the local file encrypted again with the salt
+	// in their header, which reproduces their stored bytes
+	var salt []byte
+	if isEncrypted(head.Metadata) {
+		if b.Client.encryptionKey == nil {
+			fail(VerifyUnverified, "object is encrypted client-side, but no encryption key is set")
+			return
+		}
+		if salt, err = b.objectSalt(object.path, object.sseKey); err != nil {
+			fail(VerifyUnverified, "couldn't read encryption header: %v", err)
+			return
+		}
+		result.Method = "encrypted-" + result.Method
+	}
+
+	// Objects uploaded in parts are hashed in parts of the same size
+	var partSize int64
+	if parts := partCount(stored); parts == 1 {
+		partSize = aws.ToInt64(head.ContentLength)
+	} else if parts > 1 {
+		if partSize, err = b.objectPartSize(object.path, object.sseKey); err != nil {
+			fail(VerifyUnverified, "couldn't get part size: %v", err)
+			return
+		}
+	}
+	if partSize > 0 {
+		result.Method = "multipart-" + result.Method
+	}
+
+	computed, err := b.storedDigest(local.path, algorithm, partSize, salt)
+	if err != nil {
+		fail(VerifyUnverified, "couldn't hash local file: %v", err)
+		return
+	}
+
+	if computed != stored {
+		fail(VerifyCorrupt, "%s is %s, expected %s", result.Method, stored, computed)
+		return
+	}
+	result.Status = VerifyOK
+}
+
+// storedDigest computes the checksum with the given algorithm, or the ETag if algorithm is empty, of
+// the bytes R2 would store for a local file uploaded in parts of partSize bytes, or in a single
+// request if partSize is 0. If salt isn't nil, the file is encrypted with it and the client's key
+// first.
+func (b *R2Bucket) storedDigest(path string, algorithm types.ChecksumAlgorithm, partSize int64, salt []byte) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if salt != nil {
+		if r, err = newEncryptReaderWithSalt(file, b.Client.encryptionKey, salt); err != nil {
+			return "", err
+		}
+	}
+	if algorithm != "" {
+		return readerChecksum(r, algorithm, partSize)
+	}
+	return readerETag(r, partSize)
+}
+
+// objectSalt returns the salt in the header of an object encrypted client-side, read without
+// decrypting the object, with the object's SSE-C key if it has one.
+func (b *R2Bucket) objectSalt(bucketPath string, sseKey []byte) ([]byte, error) {
+	sse := sseCustomer(sseKey)
+	obj, err := b.Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:               aws.String(b.Name),
+		Key:                  aws.String(bucketPath),
+		Range:                aws.String(fmt.Sprintf("bytes=0-%d", encryptionHeaderSize-1)),
+		SSECustomerAlgorithm: sse.algorithm,
+		SSECustomerKey:       sse.key,
+		SSECustomerKeyMD5:    sse.keyMD5,
+	})
+	if err != nil {
+		return nil, sseCustomerError(fmt.Sprintf("r2://%s/%s", b.Name, bucketPath), sseKey, err)
+	}
+	defer obj.Body.Close()
+
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := io.ReadFull(obj.Body, header); err != nil {
+		return nil, err
+	}
+	return encryptionSalt(header)
+}
+
+// verifyDownload compares a local file against the contents of its object, downloaded and decoded,
+// filling in the result. The download is validated against the object's stored checksum and, for
+// objects encrypted client-side, authenticated, so its stored bytes are checked too.
+func (b *R2Bucket) verifyDownload(result *VerifyResult, local, object *syncEntry) {
+	result.Method = "download-md5"
+	expected, err := localETag(local.path, 0)
+	if err != nil {
+		result.Status = VerifyUnverified
+		result.Detail = fmt.Sprintf("couldn't hash local file: %v", err)
+		return
+	}
+
+	body, err := b.GetWithOptions(object.path, GetOptions{SSECustomerKey: object.sseKey})
+	if err != nil {
+		result.Status = VerifyUnverified
+		result.Detail = fmt.Sprintf("couldn't download: %v", err)
+		return
+	}
+	defer body.Close()
+	computed, err := readerETag(body, 0)
+	if errors.Is(err, ErrDecryption) {
+		result.Status = VerifyCorrupt
+		result.Detail = err.Error()
+		return
+	} else if err != nil {
+		result.Status = VerifyUnverified
+		result.Detail = fmt.Sprintf("couldn't download: %v", err)
+		return
+	}
+
+	if computed != expected {
+		result.Status = VerifyCorrupt
+		result.Detail = fmt.Sprintf("%s is %s, expected %s", result.Method, computed, expected)
+		return
+	}
+	result.Status = VerifyOK
+}
+
+// VerifyFailed reports whether any verify result is a failure that hasn't been fixed.
+func VerifyFailed(results []VerifyResult) bool {
+	for _, result := range results {
+		if result.Status != VerifyOK && !result.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintVerifyResults prints the failures among verify results, one per line, followed by the number
+// of files with each status.
+func PrintVerifyResults(results []VerifyResult) {
+	counts := make(map[VerifyStatus]int)
+	var fixed int
+	for _, result := range results {
+		counts[result.Status]++
+		if result.Status == VerifyOK {
+			continue
+		}
+
+		line := fmt.Sprintf("%-10s  %s", result.Status, result.Path)
+		if result.Detail != "" {
+			line += fmt.Sprintf(" (%s)", result.Detail)
+		}
+		if result.Fixed {
+			line += " [fixed]"
+			fixed++
+		}
+		fmt.Println(line)
+	}
+
+	fmt.Printf("%d ok, %d missing, %d corrupt, %d extra, %d unverified", counts[VerifyOK], counts[VerifyMissing],
+		counts[VerifyCorrupt], counts[VerifyExtra], counts[VerifyUnverified])
+	if fixed > 0 {
+		fmt.Printf(", %d fixed", fixed)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,286 @@
+// Continuous syncing
+
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// DefaultWatchDebounce is how long a file must go without changing before it's uploaded.
+	DefaultWatchDebounce = 2 * time.Second
+
+	// DefaultWatchReconcileInterval is how often a full sync runs while watching.
+	DefaultWatchReconcileInterval = 10 * time.Minute
+)
+
+// WatchOptions holds optional settings for watching a local directory. Sync holds the options of
+// the uploads and syncs made; with Sync.Delete set, objects are deleted as their local files are
+// removed. Files are uploaded once they've gone Debounce (DefaultWatchDebounce if zero) without
+// changing, so a file being written is uploaded once rather than on every write. A full sync runs
+// every ReconcileInterval (DefaultWatchReconcileInterval if zero) to catch changes whose events were
+// missed. Errors, if set, receives the errors that don't stop the watch, e.g. failed uploads; they
+// are logged otherwise. It may be called from another goroutine, but never concurrently.
+type WatchOptions struct {
+	Sync              SyncOptions
+	Debounce          time.Duration
+	ReconcileInterval time.Duration
+	Errors            func(error)
+}
+
+// watcher watches a local directory, uploading changed files to the objects under a prefix.
+type watcher struct {
+	bucket     *R2Bucket
+	sourcePath string
+	prefix     string
+	opts       WatchOptions
+	fsWatcher  *fsnotify.Watcher
+
+	// pending maps the paths of changed files to when they may be uploaded, unless they change again
+	pending map[string]time.Time
+
+	// dirs holds the paths of the watched directories
+	dirs map[string]bool
+
+	// reportMu serializes errors reported by the event loop and the worker
+	reportMu sync.Mutex
+}
+
+// watchJob is work done by the watcher's worker: uploading or deleting the objects of changed
+// paths, or running a full sync.
+type watchJob struct {
+	paths     []string
+	reconcile bool
+}
+
+// WatchLocalToR2 syncs a local directory to the objects with a prefix in an R2 bucket, then keeps
+// them in sync as files change, until stop is closed. Changes are detected with the operating
+// system's file notifications (e.g. inotify on Linux); subdirectories are watched as they're
+// created. If the notification queue overflows, a full sync runs straight away.
+//
+// An error is returned if the directory can't be watched or the initial sync fails to list either
+// side. Failures once watching has started don't stop it, and are passed to opts.Errors.
+func (b *R2Bucket) WatchLocalToR2(sourcePath string, prefix string, opts WatchOptions, stop <-chan struct{}) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	if opts.ReconcileInterval <= 0 {
+		opts.ReconcileInterval = DefaultWatchReconcileInterval
+	}
+	if !isDir(sourcePath) {
+		return fmt.Errorf("%s is not a directory", sourcePath)
+	}
+
+	// Notifications name files by joining their directory's path, so compare paths in clean form
+	sourcePath = filepath.Clean(sourcePath)
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("couldn't watch %s: %w", sourcePath, err)
+	}
+	defer fsWatcher.Close()
+	w := &watcher{
+		bucket:     b,
+		sourcePath: sourcePath,
+		prefix:     dirPrefix(prefix),
+		opts:       opts,
+		fsWatcher:  fsWatcher,
+		pending:    make(map[string]time.Time),
+		dirs:       make(map[string]bool),
+	}
+
+	// Watch the directory before the initial sync, so changes made during the sync aren't missed
+	if err := w.addDir(sourcePath, time.Now()); err != nil {
+		return fmt.Errorf("couldn't watch %s: %w", sourcePath, err)
+	}
+	if err := b.SyncLocalToR2WithOptions(sourcePath, prefix, opts.Sync); err != nil {
+		// Failed transfers are retried by later syncs, but failing to compare means nothing was synced
+		var transferErr *syncTransferError
+		if !errors.As(err, &transferErr) {
+			return err
+		}
+		w.report(err)
+	}
+
+	// Uploads and syncs run on a worker, so notifications keep being read while they're in progress
+	// rather than overflowing the queue. Work is queued here until the worker is free, and the
+	// worker's current job is finished before returning.
+	jobs := make(chan watchJob)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for job := range jobs {
+			w.run(job)
+		}
+	}()
+	defer func() {
+		close(jobs)
+		<-finished
+	}()
+
+	flush := time.NewTicker(max(opts.Debounce/2, time.Millisecond))
+	defer flush.Stop()
+	reconcile := time.NewTicker(opts.ReconcileInterval)
+	defer reconcile.Stop()
+	var queue []watchJob
+	for {
+		// Only offer the next job when there is one, as sends on a nil channel never proceed
+		var next chan<- watchJob
+		var job watchJob
+		if len(queue) > 0 {
+			next, job = jobs, queue[0]
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case next <- job:
+			queue = queue[1:]
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(event, time.Now())
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.report(fmt.Errorf("watch error: %w", err))
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				queue = w.queueReconcile()
+			}
+		case <-flush.C:
+			if paths := w.due(time.Now()); len(paths) > 0 {
+				queue = append(queue, watchJob{paths: paths})
+			}
+		case <-reconcile.C:
+			queue = w.queueReconcile()
+		}
+	}
+}
+
+// report passes an error that doesn't stop the watch to the Errors option, or logs it.
+func (w *watcher) report(err error) {
+	w.reportMu.Lock()
+	defer w.reportMu.Unlock()
+	if w.opts.Errors != nil {
+		w.opts.Errors(err)
+	} else {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// addDir watches a directory and its subdirectories. Files already in directories that are added
+// after the watch has started are marked as changed at now, as they may have been created before
+// their directory was watched.
+func (w *watcher) addDir(dir string, now time.Time) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			w.dirs[path] = true
+			return w.fsWatcher.Add(path)
+		}
+		if dir != w.sourcePath {
+			w.pending[path] = now.Add(w.opts.Debounce)
+		}
+		return nil
+	})
+}
+
+// handle records a file notification received at now, postponing the upload of the changed path
+// until it has gone the debounce period without changing again. New directories are watched too.
+func (w *watcher) handle(event fsnotify.Event, now time.Time) {
+	if event.Name == w.sourcePath || event.Op == fsnotify.Chmod {
+		return
+	}
+	if event.Has(fsnotify.Create) && isDir(event.Name) {
+		if err := w.addDir(event.Name, now); err != nil {
+			w.report(fmt.Errorf("couldn't watch %s: %w", event.Name, err))
+		}
+		return
+	}
+	w.pending[event.Name] = now.Add(w.opts.Debounce)
+}
+
+// due removes the changed paths whose debounce period has passed by now from the pending changes,
+// returning them. Directories are skipped, as their files have events of their own; files in
+// directories moved out of the watched directory are deleted by the next reconciliation.
+func (w *watcher) due(now time.Time) []string {
+	var paths []string
+	for path, due := range w.pending {
+		if due.After(now) {
+			continue
+		}
+		delete(w.pending, path)
+		if w.dirs[path] {
+			if !isDir(path) {
+				delete(w.dirs, path)
+			}
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// queueReconcile returns a queue of work holding only a full sync. The sync covers pending changes
+// and queued uploads, so they're dropped.
+func (w *watcher) queueReconcile() []watchJob {
+	w.pending = make(map[string]time.Time)
+	return []watchJob{{reconcile: true}}
+}
+
+// run does a job on the worker, reporting failures.
+func (w *watcher) run(job watchJob) {
+	if job.reconcile {
+		if err := w.bucket.SyncLocalToR2WithOptions(w.sourcePath, w.prefix, w.opts.Sync); err != nil {
+			w.report(fmt.Errorf("reconciliation failed: %w", err))
+		}
+		return
+	}
+	for _, path := range job.paths {
+		if err := w.sync(path); err != nil {
+			w.report(err)
+		}
+	}
+}
+
+// sync uploads a changed file to its object, or deletes the object of a removed file if deletion is
+// enabled.
+func (w *watcher) sync(path string) error {
+	relativePath, err := filepath.Rel(w.sourcePath, path)
+	if err != nil {
+		return err
+	}
+	key := w.prefix + filepath.ToSlash(relativePath)
+
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if !w.opts.Sync.Delete {
+			return nil
+		}
+		err = w.bucket.DeleteObject(key)
+		w.opts.Sync.Progress.deleted(fmt.Sprintf("r2://%s/%s", w.bucket.Name, key), err)
+		return err
+	case err != nil:
+		return err
+	case !info.Mode().IsRegular():
+		return nil
+	}
+
+	putOpts := w.opts.Sync.Put
+	putOpts.Progress = w.opts.Sync.Progress
+	return w.bucket.UploadWithOptions(path, key, putOpts)
+}
@@ -0,0 +1,285 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestWatcher returns a watcher of a new temporary directory holding the given files, with a
+// debounce period of a second. Directories aren't watched until added with addDir.
+func newTestWatcher(t *testing.T, files ...string) *watcher {
+	t.Helper()
+	sourcePath := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(sourcePath, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsWatcher.Close() })
+	return &watcher{
+		sourcePath: sourcePath,
+		prefix:     "backup/",
+		opts:       WatchOptions{Debounce: time.Second},
+		fsWatcher:  fsWatcher,
+		pending:    make(map[string]time.Time),
+		dirs:       make(map[string]bool),
+	}
+}
+
+// relativeKeys returns the paths in a map relative to the source directory, in order.
+func relativeKeys[V any](t *testing.T, w *watcher, m map[string]V) []string {
+	t.Helper()
+	var paths []string
+	for path := range m {
+		relativePath, err := filepath.Rel(w.sourcePath, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(relativePath))
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestWatchDue(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		pending     map[string]time.Duration
+		dirs        []string
+		want        []string
+		wantPending []string
+		wantDirs    []string
+	}{
+		{
+			name:        "files due and not yet due",
+			pending:     map[string]time.Duration{"a.txt": -time.Second, "b.txt": 0, "c.txt": time.Second},
+			want:        []string{"a.txt", "b.txt"},
+			wantPending: []string{"c.txt"},
+		},
+		{
+			name:     "watched directory still present",
+			pending:  map[string]time.Duration{"dir": -time.Second},
+			dirs:     []string{"dir"},
+			wantDirs: []string{"dir"},
+		},
+		{
+			name:    "watched directory removed",
+			pending: map[string]time.Duration{"gone": -time.Second, "gone/a.txt": -time.Second},
+			dirs:    []string{"dir", "gone"},
+			want:    []string{"gone/a.txt"},
+			// Only pending directories are checked
+			wantDirs: []string{"dir"},
+		},
+		{
+			name:        "removed directory not yet due",
+			pending:     map[string]time.Duration{"gone": time.Second},
+			dirs:        []string{"gone"},
+			wantPending: []string{"gone"},
+			wantDirs:    []string{"gone"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(t, "dir/a.txt")
+			for path, delay := range tt.pending {
+				w.pending[filepath.Join(w.sourcePath, path)] = now.Add(delay)
+			}
+			for _, dir := range tt.dirs {
+				w.dirs[filepath.Join(w.sourcePath, dir)] = true
+			}
+
+			got := make(map[string]bool)
+			for _, path := range w.due(now) {
+				got[path] = true
+			}
+			if paths := relativeKeys(t, w, got); !slices.Equal(paths, tt.want) {
+				t.Errorf("due = %v, want %v", paths, tt.want)
+			}
+			if pending := relativeKeys(t, w, w.pending); !slices.Equal(pending, tt.wantPending) {
+				t.Errorf("pending = %v, want %v", pending, tt.wantPending)
+			}
+			if dirs := relativeKeys(t, w, w.dirs); !slices.Equal(dirs, tt.wantDirs) {
+				t.Errorf("dirs = %v, want %v", dirs, tt.wantDirs)
+			}
+		})
+	}
+}
+
+func TestWatchHandle(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		path        string
+		op          fsnotify.Op
+		pending     map[string]time.Duration
+		wantPending map[string]time.Duration
+		wantDirs    []string
+	}{
+		{
+			name:        "written file",
+			path:        "a.txt",
+			op:          fsnotify.Write,
+			wantPending: map[string]time.Duration{"a.txt": time.Second},
+		},
+		{
+			name:        "file written again is postponed",
+			path:        "a.txt",
+			op:          fsnotify.Write,
+			pending:     map[string]time.Duration{"a.txt": -time.Second},
+			wantPending: map[string]time.Duration{"a.txt": time.Second},
+		},
+		{
+			name:        "created file",
+			path:        "a.txt",
+			op:          fsnotify.Create,
+			wantPending: map[string]time.Duration{"a.txt": time.Second},
+		},
+		{
+			name:        "removed file",
+			path:        "gone.txt",
+			op:          fsnotify.Remove,
+			wantPending: map[string]time.Duration{"gone.txt": time.Second},
+		},
+		{
+			name:        "renamed file",
+			path:        "gone.txt",
+			op:          fsnotify.Rename,
+			wantPending: map[string]time.Duration{"gone.txt": time.Second},
+		},
+		{
+			name: "permissions changed",
+			path: "a.txt",
+			op:   fsnotify.Chmod,
+		},
+		{
+			name: "watched directory itself",
+			path: ".",
+			op:   fsnotify.Write,
+		},
+		{
+			name:        "created directory is watched with its files",
+			path:        "new",
+			op:          fsnotify.Create,
+			wantPending: map[string]time.Duration{"new/b.txt": time.Second, "new/sub/c.txt": time.Second},
+			wantDirs:    []string{"new", "new/sub"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWatcher(t, "a.txt", "new/b.txt", "new/sub/c.txt")
+			for path, delay := range tt.pending {
+				w.pending[filepath.Join(w.sourcePath, path)] = now.Add(delay)
+			}
+
+			w.handle(fsnotify.Event{Name: filepath.Join(w.sourcePath, tt.path), Op: tt.op}, now)
+
+			got := make(map[string]time.Duration)
+			for path, due := range w.pending {
+				relativePath, _ := filepath.Rel(w.sourcePath, path)
+				got[filepath.ToSlash(relativePath)] = due.Sub(now)
+			}
+			if len(got) != len(tt.wantPending) {
+				t.Errorf("pending = %v, want %v", got, tt.wantPending)
+			}
+			for path, delay := range tt.wantPending {
+				if got[path] != delay {
+					t.Errorf("pending = %v, want %v", got, tt.wantPending)
+					break
+				}
+			}
+			if dirs := relativeKeys(t, w, w.dirs); !slices.Equal(dirs, tt.wantDirs) {
+				t.Errorf("dirs = %v, want %v", dirs, tt.wantDirs)
+			}
+		})
+	}
+}
+
+func TestWatchAddDir(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := newTestWatcher(t, "a.txt", "logs/b.txt", "logs/2024/c.txt")
+
+	// The watched directory's files are covered by the initial sync, so only its directories are
+	// registered
+	if err := w.addDir(w.sourcePath, now); err != nil {
+		t.Fatal(err)
+	}
+	if dirs := relativeKeys(t, w, w.dirs); !slices.Equal(dirs, []string{".", "logs", "logs/2024"}) {
+		t.Errorf("dirs = %v, want ., logs and logs/2024", dirs)
+	}
+	if len(w.pending) > 0 {
+		t.Errorf("pending = %v, want none", relativeKeys(t, w, w.pending))
+	}
+	watched := make(map[string]bool)
+	for _, path := range w.fsWatcher.WatchList() {
+		watched[path] = true
+	}
+	if paths := relativeKeys(t, w, watched); !slices.Equal(paths, []string{".", "logs", "logs/2024"}) {
+		t.Errorf("watched = %v, want ., logs and logs/2024", paths)
+	}
+
+	// Files in directories added later may predate their watch, so they're marked as changed
+	if err := os.MkdirAll(filepath.Join(w.sourcePath, "new/sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(w.sourcePath, "new/sub/d.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.addDir(filepath.Join(w.sourcePath, "new"), now); err != nil {
+		t.Fatal(err)
+	}
+	if dirs := relativeKeys(t, w, w.dirs); !slices.Equal(dirs, []string{".", "logs", "logs/2024", "new", "new/sub"}) {
+		t.Errorf("dirs = %v, want the new directories added", dirs)
+	}
+	if pending := relativeKeys(t, w, w.pending); !slices.Equal(pending, []string{"new/sub/d.txt"}) {
+		t.Errorf("pending = %v, want new/sub/d.txt", pending)
+	}
+	if due := w.pending[filepath.Join(w.sourcePath, "new/sub/d.txt")]; !due.Equal(now.Add(w.opts.Debounce)) {
+		t.Errorf("new/sub/d.txt is due at %s, want %s", due, now.Add(w.opts.Debounce))
+	}
+
+	// Directories that can't be read are reported
+	if err := w.addDir(filepath.Join(w.sourcePath, "missing"), now); err == nil {
+		t.Error("addDir of a missing directory succeeded, want an error")
+	}
+}
+
+func TestWatchSyncDelete(t *testing.T) {
+	for _, deleteObjects := range []bool{false, true} {
+		w := newTestWatcher(t, "kept.txt")
+		b, stub := newStubBucket(t)
+		w.bucket = b
+		w.opts.Sync.Delete = deleteObjects
+		stub.objects["/bucket/backup/gone.txt"] = &stubObject{etag: `"gone"`}
+
+		// Removed files' objects are only deleted with Delete set
+		if err := w.sync(filepath.Join(w.sourcePath, "gone.txt")); err != nil {
+			t.Fatalf("sync of a removed file with Delete %v: %v", deleteObjects, err)
+		}
+		if stub.exists("backup/gone.txt") == deleteObjects {
+			t.Errorf("sync of a removed file with Delete %v: object exists = %v", deleteObjects, !deleteObjects)
+		}
+
+		// Existing files are uploaded either way
+		if err := w.sync(filepath.Join(w.sourcePath, "kept.txt")); err != nil {
+			t.Fatalf("sync of an existing file with Delete %v: %v", deleteObjects, err)
+		}
+		if !stub.exists("backup/kept.txt") {
+			t.Errorf("sync of an existing file with Delete %v didn't upload it", deleteObjects)
+		}
+	}
+}